@@ -0,0 +1,175 @@
+package multicache
+
+import (
+	"runtime"
+	"sort"
+	"sync/atomic"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Buffered access recording, the approach Caffeine takes. Algorithms that need
+the exclusive lock on every Get, like LeastRecentlyUsed, can instead have Gets
+take the read lock and note the access in a buffer. The buffers are drained into
+the algorithm under the exclusive lock before the next Add or when one fills.
+**/
+
+const (
+	// Accesses each stripe holds before it has to be drained
+	accessStripeSize = 16
+	// Upper bound on the number of stripes
+	maxAccessStripes = 64
+)
+
+// One access waiting to be passed to the algorithm.
+type bufferedAccess struct {
+	// Orders accesses across stripes when draining
+	sequence uint64
+	slot     Slot
+	// MulticacheItem.generation when the access happened, the access is
+	// dropped if the slot has been emptied since
+	generation uint32
+}
+
+/**
+A lossy ring of accesses. Gets holding the read lock claim an entry by
+incrementing writes, so each entry has a single writer, and accesses that find
+the stripe full are dropped. Draining holds the exclusive lock so no Get can be
+writing at the same time.
+**/
+type accessStripe struct {
+	writes  uint32
+	entries [accessStripeSize]bufferedAccess
+	// Keeps the next stripe's counter off this stripe's cache line
+	_ [64]byte
+}
+
+type accessBuffer struct {
+	// Each access takes the next sequence number and the stripe it picks,
+	// spreading concurrent Gets over the stripes even if they all use the same
+	// key.
+	sequence uint64
+	stripes  []accessStripe
+
+	// The sequence number when the buffers were last drained
+	drained uint64
+	// Reused by drain to put the accesses back in order
+	ordered []bufferedAccess
+}
+
+func newAccessBuffer() *accessBuffer {
+	count := 1
+	for count < 4*runtime.GOMAXPROCS(0) && count < maxAccessStripes {
+		count *= 2
+	}
+
+	return &accessBuffer{
+		stripes: make([]accessStripe, count),
+		ordered: make([]bufferedAccess, count*accessStripeSize),
+	}
+}
+
+// Records an access, returning true if the stripe is full and should be
+// drained. Must be called with at least the read lock held.
+func (b *accessBuffer) record(item *MulticacheItem) (full bool) {
+	sequence := atomic.AddUint64(&b.sequence, 1)
+	stripe := &b.stripes[sequence&uint64(len(b.stripes)-1)]
+
+	index := atomic.AddUint32(&stripe.writes, 1) - 1
+	if index >= accessStripeSize {
+		return true
+	}
+
+	stripe.entries[index] = bufferedAccess{sequence: sequence, slot: item.slot, generation: item.generation}
+	return index == accessStripeSize-1
+}
+
+// Passes the recorded accesses to the policy in the order they happened,
+// skipping those whose slot has since been emptied. Must be called with the
+// exclusive lock held.
+func (b *accessBuffer) drain(itemList []*MulticacheItem, policy ReplacementAlgorithmV2) {
+	// Accesses since the last drain were numbered from drained+1, so unless
+	// too many were dropped each can go straight to its place.
+	start := b.drained + 1
+	span := b.sequence - b.drained
+	b.drained = b.sequence
+
+	if span == 0 {
+		return
+	}
+
+	ordered := b.ordered[:0]
+	direct := span <= uint64(len(b.ordered))
+	if direct {
+		ordered = b.ordered[:span]
+		for i := range ordered {
+			ordered[i].sequence = 0
+		}
+	}
+
+	for i := range b.stripes {
+		stripe := &b.stripes[i]
+
+		count := stripe.writes
+		if count > accessStripeSize {
+			count = accessStripeSize
+		}
+
+		for _, access := range stripe.entries[:count] {
+			if direct {
+				ordered[access.sequence-start] = access
+			} else {
+				ordered = append(ordered, access)
+			}
+		}
+
+		stripe.writes = 0
+	}
+
+	if !direct {
+		sort.Slice(ordered, func(i, j int) bool {
+			return ordered[i].sequence < ordered[j].sequence
+		})
+	}
+
+	for _, access := range ordered {
+		// Gaps are accesses that were dropped
+		if access.sequence == 0 {
+			continue
+		}
+
+		item := itemList[access.slot]
+		if item.generation == access.generation && !item.empty() {
+			policy.OnAccess(access.slot)
+		}
+	}
+}
+
+// Drops every recorded access. Must be called with the exclusive lock held.
+func (b *accessBuffer) clear() {
+	b.drained = b.sequence
+	for i := range b.stripes {
+		b.stripes[i].writes = 0
+	}
+}
+
+// Drains the buffers unless another goroutine holds the lock, in which case
+// the accesses that don't fit are lost.
+func (mc *Multicache) tryDrainAccesses() {
+	if mc.lock.TryLock() {
+		mc.drainAccesses()
+		mc.lock.Unlock()
+	}
+}
+
+// Passes buffered accesses to the algorithm, call with the exclusive lock.
+func (mc *Multicache) drainAccesses() {
+	if mc.accesses != nil {
+		mc.accesses.drain(mc.itemList, mc.policy)
+	}
+}
@@ -0,0 +1,154 @@
+package multicache
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// A recordingPolicy whose accesses are buffered.
+type bufferedRecordingPolicy struct {
+	recordingPolicy
+}
+
+func (b *bufferedRecordingPolicy) BuffersAccesses() bool {
+	return true
+}
+
+func TestBufferedAccessesEnabled(t *testing.T) {
+	testcases := []struct {
+		algorithm ReplacementAlgorithm
+		buffered  bool
+	}{
+		{&LeastRecentlyUsed{}, true},
+		{&SecondChance{}, false},
+		{&RoundRobin{}, false},
+	}
+
+	for _, testcase := range testcases {
+		mc, _ := NewMulticache(10, testcase.algorithm)
+		assert(t, (mc.accesses != nil) == testcase.buffered, "Accesses buffered for the wrong algorithms")
+	}
+}
+
+func TestBufferedAccessesDrainedBeforeAdd(t *testing.T) {
+	policy := &bufferedRecordingPolicy{recordingPolicy{hidden: make(map[Slot]bool)}}
+	mc, _ := NewMulticacheV2(2, policy)
+
+	mc.Add("a", 1)
+	mc.Add("b", 2)
+	policy.events = nil
+
+	_, ok := mc.Get("b")
+	assert(t, ok, "Buffered Get missed")
+	mc.Get("a")
+	mc.Get("missing")
+	assert(t, len(policy.events) == 0, "Access passed on before the buffer was drained")
+
+	mc.Add("c", 3)
+	expected := []string{"access 1", "access 0", "remove 0 evicted", "insert 0 c"}
+	assert(t, reflect.DeepEqual(policy.events, expected), "Accesses not drained in order before the Add")
+}
+
+func TestBufferedAccessesToRemovedItems(t *testing.T) {
+	policy := &bufferedRecordingPolicy{recordingPolicy{hidden: make(map[Slot]bool)}}
+	mc, _ := NewMulticacheV2(2, policy)
+
+	mc.Add("a", 1)
+	mc.Add("b", 2)
+	mc.Get("a")
+	mc.Remove("a")
+	policy.events = nil
+
+	// c reuses a's slot, the access to a mustn't count for it
+	mc.Add("c", 3)
+	assert(t, reflect.DeepEqual(policy.events, []string{"insert 0 c"}), "Access to a removed item passed on")
+
+	mc.Get("c")
+	mc.Purge()
+	policy.events = nil
+	mc.Add("d", 4)
+	assert(t, reflect.DeepEqual(policy.events, []string{"insert 0 d"}), "Purge kept buffered accesses")
+}
+
+func TestBufferedAccessesDrainedWhenFull(t *testing.T) {
+	policy := &bufferedRecordingPolicy{recordingPolicy{hidden: make(map[Slot]bool)}}
+	mc, _ := NewMulticacheV2(1, policy)
+	mc.Add("a", 1)
+	policy.events = nil
+
+	// Single threaded nothing is lost, filling a stripe drains them all
+	gets := 3 * len(mc.accesses.stripes) * accessStripeSize
+	for i := 0; i < gets; i++ {
+		mc.Get("a")
+	}
+
+	assert(t, len(policy.events) > 0, "Full buffer not drained")
+
+	mc.Add("b", 2)
+	accesses := 0
+	for _, event := range policy.events {
+		if event == "access 0" {
+			accesses++
+		}
+	}
+	assert(t, accesses == gets, "Accesses lost")
+}
+
+func TestBufferedLRUExact(t *testing.T) {
+	mc, _ := NewMulticache(3, &LeastRecentlyUsed{})
+	mc.Add("a", 1)
+	mc.Add("b", 2)
+	mc.Add("c", 3)
+
+	// Far more Gets than the buffers hold, the order must survive draining
+	for i := 0; i < 999; i++ {
+		mc.Get([]string{"c", "a", "b"}[i%3])
+	}
+	mc.Get("a")
+
+	mc.Add("d", 4)
+	_, ok := mc.Get("c")
+	assert(t, !ok, "Least recently used item kept")
+	_, ok = mc.Get("a")
+	assert(t, ok, "Recently used item evicted")
+}
+
+func TestBufferedParallelGetAdd(t *testing.T) {
+	const goroutines, operations, keys = 16, 2000, 64
+
+	mc, _ := NewMulticache(keys/4, &LeastRecentlyUsed{})
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+
+			for i := 0; i < operations; i++ {
+				key := strconv.Itoa((i*5 + g) % keys)
+				value, ok := mc.Get(key)
+				if ok && value != key {
+					t.Error("Wrong value for", key)
+					return
+				}
+
+				if !ok {
+					mc.Add(key, key)
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	assert(t, mc.Len() == keys/4, "Cache not full")
+}
@@ -0,0 +1,116 @@
+package multicache
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Changing the keys of an item that's already cached without adding it again.
+**/
+
+/**
+Makes the item under existingKey reachable through newKeys as well, returning
+false if there's no such item. Like AddMany, other items stored under any of
+newKeys are replaced. The item keeps its place in the replacement algorithm,
+which is told about the new keys if it implements KeyTracking.
+**/
+func (mc *Multicache) AddAlias(existingKey string, newKeys ...string) bool {
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	item, ok := mc.kvStore[existingKey]
+	if !ok {
+		return false
+	}
+
+	// item.keys may have been handed to a RemoveListener, so build a new slice
+	keys := append([]string{}, item.keys...)
+
+	for _, key := range newKeys {
+		old, ok := mc.kvStore[key]
+		if ok && old == item {
+			continue
+		}
+
+		// Remove old references if they exist.
+		if ok {
+			mc.removeItem(old, RemoveOverwritten)
+		}
+
+		mc.kvStore[key] = item
+		if mc.keyIndex != nil {
+			mc.keyIndex.insert(key)
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) > len(item.keys) {
+		added := keys[len(item.keys):len(keys):len(keys)]
+		mc.keysChanged(item, keys)
+		mc.notifyRemoved(added)
+	}
+
+	return true
+}
+
+/**
+Drops key from its item, leaving the item reachable through its other keys.
+If key was the item's only key the item is removed like Remove. Returns false
+if there's no item under key. The RemoveListener is passed the dropped key.
+**/
+func (mc *Multicache) UnlinkKey(key string) bool {
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	item, ok := mc.kvStore[key]
+	if !ok {
+		return false
+	}
+
+	if len(item.keys) == 1 && len(item.hashedKeys) == 0 {
+		mc.notifyRemoved(item.keys)
+		mc.removeItem(item, RemoveExplicit)
+		return true
+	}
+
+	delete(mc.kvStore, key)
+	if mc.keyIndex != nil {
+		mc.keyIndex.delete(key)
+	}
+
+	keys := make([]string, 0, len(item.keys)-1)
+	for _, k := range item.keys {
+		if k != key {
+			keys = append(keys, k)
+		}
+	}
+
+	mc.keysChanged(item, keys)
+	mc.notifyRemoved([]string{key})
+	return true
+}
+
+// Gives item its new keys and tells the algorithm if it keeps track of them.
+func (mc *Multicache) keysChanged(item *MulticacheItem, keys []string) {
+	item.keys = keys
+
+	if tracking, ok := mc.policy.(KeyTracking); ok {
+		tracking.OnKeysChanged(item.slot, keys)
+	}
+}
+
+// Returns every key of the item under key, nil if there isn't one.
+func (mc *Multicache) KeysOf(key string) []string {
+	mc.readLock()
+	defer mc.lock.RUnlock()
+
+	item, ok := mc.kvStore[key]
+	if !ok {
+		return nil
+	}
+
+	return append([]string{}, item.keys...)
+}
@@ -0,0 +1,118 @@
+package multicache
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func TestAddAlias(t *testing.T) {
+	mc, _ := NewMulticache(3, &RoundRobin{})
+	mc.Add("a", 1)
+	mc.Add("other", 2)
+
+	assert(t, !mc.AddAlias("missing", "b"), "Alias added to a missing item")
+
+	// other is replaced, a is already a key of the item
+	assert(t, mc.AddAlias("a", "b", "other", "a"), "Alias not added")
+	assert(t, reflect.DeepEqual(mc.KeysOf("b"), []string{"a", "b", "other"}), "Wrong keys")
+
+	value, ok := mc.Get("other")
+	assert(t, ok && value == 1, "Replaced key doesn't point at the item")
+	assert(t, mc.Len() == 1, "Aliased item stored twice")
+
+	// Removing any key still removes the item for all of them
+	mc.Remove("b")
+	_, ok = mc.Get("a")
+	assert(t, !ok, "Item kept after removal")
+	assert(t, mc.KeysOf("a") == nil, "Keys of a missing item")
+}
+
+func TestUnlinkKey(t *testing.T) {
+	mc, _ := NewDefaultMulticache(3)
+	mc.EnableKeyIndex()
+	mc.AddMany(1, "a", "b", "c")
+
+	removed := [][]string{}
+	mc.SetRemoveListener(func(keys []string) {
+		removed = append(removed, keys)
+	})
+
+	assert(t, mc.UnlinkKey("b"), "Key not unlinked")
+	assert(t, !mc.UnlinkKey("b"), "Missing key unlinked")
+
+	_, ok := mc.Get("b")
+	assert(t, !ok, "Unlinked key found")
+	value, ok := mc.Get("c")
+	assert(t, ok && value == 1, "Item lost with its key")
+	assert(t, reflect.DeepEqual(mc.KeysOf("a"), []string{"a", "c"}), "Wrong keys after unlinking")
+	assert(t, reflect.DeepEqual(mc.KeysWithPrefix(""), []string{"a", "c"}), "Key index out of step")
+	assert(t, reflect.DeepEqual(removed, [][]string{{"b"}}), "Unlinked key not reported")
+
+	// The last key takes the item with it
+	mc.UnlinkKey("a")
+	mc.UnlinkKey("c")
+	assert(t, mc.Len() == 0, "Item without keys kept")
+	assert(t, reflect.DeepEqual(removed, [][]string{{"b"}, {"a"}, {"c"}}), "Wrong keys reported")
+}
+
+func TestKeysOfAfterRemoveListener(t *testing.T) {
+	mc, _ := NewDefaultMulticache(3)
+	mc.AddMany(1, "a", "b")
+
+	// A listener's keys mustn't change when the item's keys do
+	var reported []string
+	mc.SetRemoveListener(func(keys []string) {
+		reported = keys
+	})
+
+	mc.AddMany(2, "c")
+	mc.AddAlias("c", "d")
+	mc.RemoveManyFunc(func(item interface{}) bool { return item == 2 })
+	assert(t, reflect.DeepEqual(reported, []string{"c", "d"}), "Wrong keys reported")
+
+	keys := mc.KeysOf("a")
+	keys[0] = "changed"
+	assert(t, mc.KeysOf("a")[0] == "a", "KeysOf exposed the item's keys")
+}
+
+func TestAddAliasReportsKeys(t *testing.T) {
+	mc, _ := NewDefaultMulticache(3)
+	mc.Add("a", 1)
+
+	removed := [][]string{}
+	mc.SetRemoveListener(func(keys []string) {
+		removed = append(removed, keys)
+	})
+
+	mc.AddAlias("a", "b", "a", "c")
+	mc.AddAlias("a", "b")
+	assert(t, reflect.DeepEqual(removed, [][]string{{"b", "c"}}), "Added keys not reported")
+}
+
+func TestAliasesNotifyPolicy(t *testing.T) {
+	policy := &recordingPolicy{hidden: make(map[Slot]bool)}
+	mc, _ := NewMulticacheV2(2, policy)
+	mc.Add("a", 1)
+
+	mc.AddAlias("a", "b")
+	mc.UnlinkKey("a")
+	mc.UnlinkKey("b")
+
+	expected := []string{
+		"reset 2",
+		"insert 0 a",
+		"keys 0 a,b",
+		"keys 0 b",
+		"remove 0 explicit",
+	}
+	assert(t, reflect.DeepEqual(policy.events, expected), fmt.Sprint("Unexpected events: ", policy.events))
+}
@@ -0,0 +1,69 @@
+package multicache
+
+import "sync/atomic"
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+/**
+ApproximateLRU replaces an item that hasn't been used for about the longest.
+
+Unlike LeastRecentlyUsed, a Get doesn't take a new number from a shared
+counter, it stamps the item with the count of inserts so far. Items used
+between the same two inserts look equally recent, so the victim may not be the
+exact least recently used item, but Gets only read the counter and store the
+Tag atomically so they just take the read lock, see ConcurrentRetriever.
+
+Finding the victim takes O(n) time like LeastRecentlyUsed.
+**/
+type ApproximateLRU struct {
+	// One more than the number of items inserted since the last reset, so
+	// empty slots (Tag 0) are always the oldest.
+	clock int64
+}
+
+func (rof *ApproximateLRU) InitItem(item *MulticacheItem) {
+	// Items used after this insert get a later stamp than it
+	atomic.StoreInt64(&item.Tag, atomic.AddInt64(&rof.clock, 1)-1)
+}
+
+func (rof *ApproximateLRU) Reset(multicache *Multicache) {
+	atomic.StoreInt64(&rof.clock, 1)
+}
+
+func (rof *ApproximateLRU) GetNextReplacement(multicache *Multicache) *MulticacheItem {
+	minItem := multicache.itemList[0]
+	minTag := atomic.LoadInt64(&minItem.Tag)
+
+	for _, item := range multicache.itemList {
+		if tag := atomic.LoadInt64(&item.Tag); tag < minTag {
+			minItem, minTag = item, tag
+		}
+	}
+
+	return minItem
+}
+
+func (rof *ApproximateLRU) UpdatesOnRetrieved() bool {
+	return true
+}
+
+func (rof *ApproximateLRU) ItemRetrieved(item *MulticacheItem) bool {
+	// Only store when the stamp changes so hot items don't bounce between
+	// processors.
+	now := atomic.LoadInt64(&rof.clock)
+	if atomic.LoadInt64(&item.Tag) != now {
+		atomic.StoreInt64(&item.Tag, now)
+	}
+
+	return true
+}
+
+func (rof *ApproximateLRU) RetrievesConcurrently() bool {
+	return true
+}
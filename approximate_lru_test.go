@@ -0,0 +1,32 @@
+package multicache
+
+import "testing"
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+var approximateLRUTestCases = []ReplacementAlgorithmTestcase{
+	// Miss all items because they aren't in cache
+	{&ApproximateLRU{}, 4, []string{"a", "b", "c", "d", "e"}, []bool{false, false, false, false, false}, 0},
+	// Overwrite the first element and try it again
+	{&ApproximateLRU{}, 3, []string{"a", "b", "c", "d", "a"}, []bool{false, false, false, false, false}, 0},
+	// Overwrite multiple in a row
+	{&ApproximateLRU{}, 2, []string{"a", "b", "c", "a", "b", "c"}, []bool{false, false, false, false, false, false}, 0},
+	// Hit things
+	{&ApproximateLRU{}, 2, []string{"a", "b", "a", "b"}, []bool{false, false, true, true}, 0},
+	// Make sure we didn't get rid of the thing we've used since the last insert
+	{&ApproximateLRU{}, 2, []string{"a", "b", "a", "c", "a", "c"}, []bool{false, false, true, false, true, true}, 0},
+	// A more complex example, we should trash b
+	{&ApproximateLRU{}, 3, []string{"a", "b", "c", "c", "a", "d", "b"}, []bool{false, false, false, true, true, false, false}, 0}}
+
+func TestApproximateLRU(t *testing.T) {
+
+	for _, testcase := range approximateLRUTestCases {
+		testcase.RunTest(t)
+	}
+}
@@ -1,5 +1,10 @@
 package multicache
 
+import (
+	"container/heap"
+	"io"
+)
+
 /**
 This file is part of multicache, a library for handling caches with multiple
 keys and replacement algorithms.
@@ -41,109 +46,342 @@ func CalculateHitMiss(items []string, cacheSize uint64, algorithm ReplacementAlg
 	return algorithmHitMissRatio
 }
 
+/** Like CalculateHitMiss but replays a trace as it is read, so traces larger
+than memory can be used.
+
+Only Gets count towards the ratio. A Get that misses is filled by the Add that
+follows it if that Add includes the missed key, as happens in a recorded
+application, otherwise the missed key is added along with any aliases the Get
+declares like CalculateHitMiss does. Other Adds and Removes in the trace are
+applied to the cache as they happen.
+**/
+func CalculateHitMissTrace(trace TraceReader, cacheSize uint64, algorithm ReplacementAlgorithm) (ratio float64, err error) {
+	if cacheSize <= 0 {
+		return 0, nil
+	}
+
+	mc, _ := NewMulticache(cacheSize, algorithm)
+	replay := &traceReplay{mc: mc}
+
+	for {
+		event, err := trace.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		replay.apply(event)
+	}
+
+	return replay.ratio(), nil
+}
+
+// The hit ratios of a trace with and without its aliases.
+type MultiKeyResult struct {
+	// Misses add the looked up key and every alias together with AddMany, so
+	// a later Get of any alias hits the shared item.
+	HitRatio float64
+	// Every key is cached as an item of its own, as if the application
+	// didn't use multiple keys.
+	SingleKeyHitRatio float64
+}
+
 /**
-	Returns Bélády's optimal ratio for the given input with a cache of the same size.
+Measures how much grouping keys helps a trace whose Gets declare the aliases
+of the item they look up, such as those from workload.Trace. Each alias group
+takes one slot instead of one per key, so the same cache holds more.
+
+The trace is replayed once into two caches of cacheSize, one like
+CalculateHitMissTrace and one that caches every key separately, each using its
+own algorithm from newAlgorithm.
 **/
-func CalculateOptimalHitMiss(items []string, cacheSize uint64) (ratio float64) {
-	//log.Printf("doing %v size %v\n", items, cacheSize)
-	// If we fit everything in cache, ratio = 0 because we have to insert
-	// everything.
+func CalculateMultiKeyHitMiss(trace TraceReader, cacheSize uint64, newAlgorithm AlgorithmFactory) (result MultiKeyResult, err error) {
 	if cacheSize <= 0 {
-		return 0.0
+		return result, nil
 	}
 
-	// The "cache" holds the item key and a boolean of whether or not the key
-	// is in the cache.
-	cache := make(map[string]bool)
+	grouped, _ := NewMulticache(cacheSize, newAlgorithm())
+	single, _ := NewMulticache(cacheSize, newAlgorithm())
+	replays := []*traceReplay{{mc: grouped}, {mc: single, singleKey: true}}
 
-	// Initially nothing is in the cache
-	for _, item := range items {
-		cache[item] = false
+	for {
+		event, err := trace.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return result, err
+		}
+
+		for _, replay := range replays {
+			replay.apply(event)
+		}
 	}
 
-	hits := 0
-	misses := 0
+	result.HitRatio = replays[0].ratio()
+	result.SingleKeyHitRatio = replays[1].ratio()
+	return result, nil
+}
 
-	// Insert our original number of cache items which are all misses
-	for _, key := range items {
-		cache[key] = false
+// Applies trace events to a cache, counting the hits and misses of Gets.
+type traceReplay struct {
+	mc     *Multicache
+	hits   int
+	misses int
+
+	// Ignore aliases, caching each key as its own item
+	singleKey bool
+
+	// The keys of a miss that hasn't been filled yet
+	pendingFill []string
+}
+
+func (r *traceReplay) apply(event TraceEvent) {
+	// Readers other than the built in ones may return events without keys,
+	// skip them like ReadTraceGets does.
+	if len(event.Keys) == 0 {
+		return
 	}
 
-	// while the cache is not full yet and we haven't run out of items
-	// add the items to the cache to get to capacity if they aren't there
-	// already
-	index := 0
-	for ; uint64(misses) < cacheSize && index < len(items); index++ {
-		key := items[index]
-		res, _ := cache[key]
-		if res == true {
-			hits++
-			continue
+	switch event.Op {
+	case TraceGet:
+		r.fill()
+
+		_, ok := r.mc.Get(event.Keys[0])
+		if ok {
+			r.hits++
+		} else {
+			r.misses++
+			r.pendingFill = event.Keys
+		}
+	case TraceAdd:
+		if len(r.pendingFill) == 0 || !containsKey(event.Keys, r.pendingFill[0]) {
+			r.fill()
+		}
+
+		r.pendingFill = nil
+		r.add(event.Keys)
+	case TraceRemove:
+		r.fill()
+
+		for _, key := range event.Keys {
+			r.mc.Remove(key)
 		}
+	}
+}
+
+func (r *traceReplay) fill() {
+	if len(r.pendingFill) > 0 {
+		if r.singleKey {
+			r.pendingFill = r.pendingFill[:1]
+		}
+
+		r.add(r.pendingFill)
+		r.pendingFill = nil
+	}
+}
+
+func (r *traceReplay) add(keys []string) {
+	if !r.singleKey {
+		r.mc.AddMany(keys[0], uniqueKeys(keys)...)
+		return
+	}
+
+	for _, key := range keys {
+		r.mc.Add(key, key)
+	}
+}
 
-		cache[key] = true
-		misses++
+func (r *traceReplay) ratio() float64 {
+	if r.hits+r.misses == 0 {
+		return 0
 	}
-	//log.Printf("pre iteration hits: %v, misses: %v\n", hits, misses)
 
-	for ; index < len(items); index++ {
-		nextToAdd := items[index]
-		nextToRemove := ""
-		val := cache[nextToAdd]
-		if val == true {
-			// found
+	return float64(r.hits) / float64(r.misses+r.hits)
+}
+
+// Drops repeated keys, which AddMany doesn't allow.
+func uniqueKeys(keys []string) []string {
+	for i := 1; i < len(keys); i++ {
+		if containsKey(keys[:i], keys[i]) {
+			unique := append([]string{}, keys[:i]...)
+			for _, key := range keys[i+1:] {
+				if !containsKey(unique, key) {
+					unique = append(unique, key)
+				}
+			}
+
+			return unique
+		}
+	}
+
+	return keys
+}
+
+/** Like CalculateHitMissTrace but reads a text or binary trace from r.
+**/
+func CalculateHitMissReader(r io.Reader, cacheSize uint64, algorithm ReplacementAlgorithm) (ratio float64, err error) {
+	trace, err := NewTraceReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	return CalculateHitMissTrace(trace, cacheSize, algorithm)
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+/**
+	Returns Bélády's optimal ratio for the given input with a cache of the same size.
+
+The next use of every item is found up front and the cached items are kept in
+a heap ordered by their next use, so finding the item to evict takes O(log n)
+and the whole calculation O(n log n).
+**/
+func CalculateOptimalHitMiss(items []string, cacheSize uint64) (ratio float64) {
+	ratio, _ = CalculateOptimalSizedHitMiss(items, nil, cacheSize)
+	return ratio
+}
+
+/**
+Like CalculateOptimalHitMiss but for items of different sizes in a cache that
+holds cacheBytes bytes, sizes[i] being the size of items[i]. Each miss evicts
+the items used furthest in the future until the new one fits, items larger than
+the whole cache are never inserted.
+
+Returns the ratio of requests that hit and the ratio of requested bytes that
+hit. A nil sizes gives every item a size of 1, as does a size of 0 (unknown).
+An item keeps the size it had when it was inserted.
+
+Picking victims by next use alone isn't always optimal once sizes differ, but
+it is the usual bound to compare algorithms against.
+**/
+func CalculateOptimalSizedHitMiss(items []string, sizes []int64, cacheBytes uint64) (ratio, byteRatio float64) {
+	// A cache that can't hold anything never hits
+	if cacheBytes <= 0 {
+		return 0.0, 0.0
+	}
+
+	ids, keyCount, nextUse := nextUses(items)
+
+	// The next use of each cached key, or -1 if the key isn't cached. Heap
+	// entries that don't match are stale and skipped.
+	cachedNext := make([]int, keyCount)
+	cachedSize := make([]uint64, keyCount)
+	for id := range cachedNext {
+		cachedNext[id] = -1
+	}
+
+	queue := &optimalHeap{}
+	var used, hitBytes, totalBytes uint64
+	hits := 0
+	misses := 0
+
+	for index, id := range ids {
+		size := uint64(1)
+		if sizes != nil && sizes[index] > 0 {
+			size = uint64(sizes[index])
+		}
+		totalBytes += size
+
+		if cachedNext[id] >= 0 {
 			hits++
+			hitBytes += size
 		} else {
-			// not found, remove the furthest item and return the closest
-			nextToRemove = furthestFunc(index, &cache, &items)
-			if nextToRemove != nextToAdd && nextToRemove != "" {
-				cache[nextToAdd] = true
-				cache[nextToRemove] = false
-			}
 			misses++
+			if size > cacheBytes {
+				continue
+			}
+
+			for used+size > cacheBytes {
+				victim := heap.Pop(queue).(optimalEntry)
+				if cachedNext[victim.id] != victim.nextUse {
+					continue
+				}
+
+				cachedNext[victim.id] = -1
+				used -= cachedSize[victim.id]
+			}
+
+			cachedSize[id] = size
+			used += size
 		}
 
-		//log.Printf("val: %v, wasHit: %v, nextToRemove: %v cache: %v\n", nextToAdd, val, nextToRemove, cache)
+		cachedNext[id] = nextUse[index]
+		heap.Push(queue, optimalEntry{nextUse: nextUse[index], id: id})
 	}
 
-	//log.Printf("post iteration hits: %v, misses: %v\n", hits, misses)
-
 	// avoid division errors
 	if misses == 0 {
-		return 1
+		return 1, 1
 	}
 
-	// calculate the result
-	algorithmHitMissRatio := float64(hits) / float64(misses+hits)
-	return algorithmHitMissRatio
+	ratio = float64(hits) / float64(misses+hits)
+	byteRatio = float64(hitBytes) / float64(totalBytes)
+	return ratio, byteRatio
 }
 
-// This function will find the cache items that are going to be replaced farthest
-// in the future
-func furthestFunc(tmpIndex int, cache *map[string]bool, items *[]string) string {
-
-	// Holds all the items in the cache
-	cacheCopy := make(map[string]bool)
-	for key, held := range *cache {
-		if held == true {
-			cacheCopy[key] = true
+/**
+Numbers the distinct items and finds the index each item is next used at,
+len(items) if it never is. Returns the number of each item, the count of
+distinct items and the next uses.
+**/
+func nextUses(items []string) (ids []int, keyCount int, nextUse []int) {
+	numbers := make(map[string]int)
+	ids = make([]int, len(items))
+	for index, item := range items {
+		id, ok := numbers[item]
+		if !ok {
+			id = len(numbers)
+			numbers[item] = id
 		}
-	}
 
-	// scan the list of items, removing each until we reach the end of the
-	// list, or we get the item used farthest in the future.
-	for ; tmpIndex < len(*items) && len(cacheCopy) > 1; tmpIndex++ {
-		usedItem := (*items)[tmpIndex]
-		delete(cacheCopy, usedItem)
+		ids[index] = id
 	}
 
-	furthestKey := ""
+	keyCount = len(numbers)
+	lastSeen := make([]int, keyCount)
+	for id := range lastSeen {
+		lastSeen[id] = len(items)
+	}
 
-	// Return an item in the map
-	for k, _ := range cacheCopy {
-		furthestKey = k
-		break
+	nextUse = make([]int, len(items))
+	for index := len(items) - 1; index >= 0; index-- {
+		nextUse[index] = lastSeen[ids[index]]
+		lastSeen[ids[index]] = index
 	}
 
-	return furthestKey
+	return ids, keyCount, nextUse
+}
+
+// A cached item and the index it's next used at.
+type optimalEntry struct {
+	nextUse int
+	id      int
+}
+
+// Max heap of cached items by next use, implements heap.Interface
+type optimalHeap []optimalEntry
+
+func (h optimalHeap) Len() int           { return len(h) }
+func (h optimalHeap) Less(i, j int) bool { return h[i].nextUse > h[j].nextUse }
+func (h optimalHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *optimalHeap) Push(x interface{}) {
+	*h = append(*h, x.(optimalEntry))
+}
+
+func (h *optimalHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
 }
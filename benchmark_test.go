@@ -1,6 +1,11 @@
 package multicache
 
-import "testing"
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
 
 /**
 This file is part of multicache, a library for handling caches with multiple
@@ -78,6 +83,66 @@ func TestOptimal(t *testing.T) {
 	}
 }
 
+func TestOptimalMatchesReference(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+
+	for run := 0; run < 200; run++ {
+		items := make([]string, random.Intn(200))
+		keys := 1 + random.Intn(30)
+		for i := range items {
+			items[i] = strconv.Itoa(random.Intn(keys))
+		}
+
+		cacheSize := uint64(random.Intn(keys + 2))
+		expected := referenceOptimalHitMiss(items, cacheSize)
+		result := CalculateOptimalHitMiss(items, cacheSize)
+
+		if result != expected {
+			t.Fatal("Unexpected result, run:", run, "result:", result, "expected:", expected, "items:", items, "size:", cacheSize)
+		}
+	}
+}
+
+type SizedOptimalTestcase struct {
+	items             []string
+	sizes             []int64
+	cacheBytes        uint64
+	expectedResult    float64
+	expectedByteRatio float64
+}
+
+var sizedOptimalTestcases = []SizedOptimalTestcase{
+	// Without sizes every item takes 1 byte
+	{[]string{"a", "b", "a", "a"}, nil, 2, 0.5, 0.5},
+	// c evicts a rather than b, the last a evicts whatever it needs to
+	{[]string{"a", "b", "a", "c", "b", "a"}, []int64{2, 1, 2, 2, 1, 2}, 3, 2.0 / 6.0, 3.0 / 10.0},
+	// z never fits so it doesn't evict anything
+	{[]string{"a", "b", "a", "z", "c", "b", "a"}, []int64{2, 1, 2, 5, 2, 1, 2}, 3, 2.0 / 7.0, 3.0 / 15.0},
+	// Unknown sizes count as 1
+	{[]string{"a", "b", "a", "b"}, []int64{0, 0, 0, 0}, 2, 0.5, 0.5},
+	// Nothing fits
+	{[]string{"a", "a"}, []int64{1, 1}, 0, 0.0, 0.0},
+}
+
+func TestOptimalSized(t *testing.T) {
+	for index, test := range sizedOptimalTestcases {
+		result, byteRatio := CalculateOptimalSizedHitMiss(test.items, test.sizes, test.cacheBytes)
+
+		if result != test.expectedResult || byteRatio != test.expectedByteRatio {
+			t.Error("Unexpected result, index:", index, "result:", result, "byte ratio:", byteRatio, "testcase:", test)
+		}
+	}
+}
+
+func TestOptimalSizedTrace(t *testing.T) {
+	trace := NewCSVTraceReader(strings.NewReader("ts,key,size\n1,a,2\n2,b,1\n3,a,2\n4,c,2\n5,b,1\n6,a,2\n"))
+	keys, sizes, err := ReadTraceGets(trace)
+	assert(t, err == nil && len(keys) == 6 && sizes[0] == 2, "Trace not read")
+
+	result, byteRatio := CalculateOptimalSizedHitMiss(keys, sizes, 3)
+	assert(t, result == 2.0/6.0 && byteRatio == 3.0/10.0, "Unexpected sized optimal for trace")
+}
+
 // We're just testing that this function works, so we use a basic known
 // algorithm rather than something more complex. The algorithms themselves are
 // tested in their respective testing functions.
@@ -132,3 +197,176 @@ func TestCalculateHitMiss(t *testing.T) {
 		}
 	}
 }
+
+func TestCalculateHitMissTrace(t *testing.T) {
+	// Plain lists of keys behave exactly like CalculateHitMiss
+	for index, test := range hitmissTestcases {
+		result, err := CalculateHitMissTrace(NewKeyTraceReader(test.items), test.cacheSize, test.algorithm)
+
+		if err != nil || result != test.expectedResult {
+			t.Error("Unexpected result, index:", index, "result:", result, "err:", err, "testcase:", test)
+		}
+	}
+}
+
+type TraceHitMissTestcase struct {
+	trace          string
+	cacheSize      uint64
+	expectedResult float64
+}
+
+var traceHitMissTestcases = []TraceHitMissTestcase{
+	// A recorded miss followed by its Add only inserts once, so b survives
+	{"0 G a\n0 A a\n0 G b\n0 A b\n0 G b\n0 G a\n", 2, 0.5},
+	// Adds with several keys make every alias hit
+	{"0 G a\n0 A a x y\n0 G x\n0 G y\n", 2, 2.0 / 3.0},
+	// Removes are applied
+	{"a\na\n0 R a\na\n", 2, 1.0 / 3.0},
+	// Adds that don't follow a miss still fill the previous miss
+	{"a\n0 A b\na\nb\n", 2, 2.0 / 3.0},
+	// Misses fill in the aliases a Get declares, repeats are ignored
+	{"0 G a b a\n0 G b\n", 2, 0.5},
+}
+
+func TestCalculateHitMissReader(t *testing.T) {
+	for index, test := range traceHitMissTestcases {
+		result, err := CalculateHitMissReader(strings.NewReader(test.trace), test.cacheSize, &RoundRobin{})
+
+		if err != nil || result != test.expectedResult {
+			t.Error("Unexpected result, index:", index, "result:", result, "err:", err, "testcase:", test)
+		}
+	}
+
+	_, err := CalculateHitMissReader(strings.NewReader("0 X a\n"), 2, &RoundRobin{})
+	assert(t, err != nil, "Invalid trace accepted")
+}
+
+func TestCalculateMultiKeyHitMiss(t *testing.T) {
+	trace := "0 G a b\n0 G b a\n0 G c\n0 G b\n"
+	newAlgorithm := func() ReplacementAlgorithm { return &LeastRecentlyUsed{} }
+
+	result, err := CalculateMultiKeyHitMiss(NewTextTraceReader(strings.NewReader(trace)), 2, newAlgorithm)
+	assert(t, err == nil, "Simulation failed")
+	assert(t, result.HitRatio == 0.5, "Aliases weren't grouped")
+	assert(t, result.SingleKeyHitRatio == 0.25, "Aliases weren't cached separately")
+}
+
+func TestCalculateHitMissKeylessEvents(t *testing.T) {
+	events := []TraceEvent{
+		{Op: TraceGet, Keys: []string{"a"}},
+		{Op: TraceGet},
+		{Op: TraceAdd},
+		{Op: TraceRemove},
+		{Op: TraceGet, Keys: []string{"a"}},
+	}
+
+	ratio, err := CalculateHitMissTrace(NewEventTraceReader(events), 2, &LeastRecentlyUsed{})
+	assert(t, err == nil, "Simulation failed")
+	assert(t, ratio == 0.5, "Keyless events weren't skipped")
+
+	result, err := CalculateMultiKeyHitMiss(NewEventTraceReader(events), 2, func() ReplacementAlgorithm { return &LeastRecentlyUsed{} })
+	assert(t, err == nil, "Multi-key simulation failed")
+	assert(t, result.HitRatio == 0.5, "Keyless events weren't skipped with aliases")
+}
+
+// The original quadratic Bélády simulation, CalculateOptimalHitMiss must give
+// the same results.
+func referenceOptimalHitMiss(items []string, cacheSize uint64) (ratio float64) {
+	// If we fit everything in cache, ratio = 0 because we have to insert
+	// everything.
+	if cacheSize <= 0 {
+		return 0.0
+	}
+
+	// The "cache" holds the item key and a boolean of whether or not the key
+	// is in the cache.
+	cache := make(map[string]bool)
+
+	// Initially nothing is in the cache
+	for _, item := range items {
+		cache[item] = false
+	}
+
+	hits := 0
+	misses := 0
+
+	// Insert our original number of cache items which are all misses
+	for _, key := range items {
+		cache[key] = false
+	}
+
+	// while the cache is not full yet and we haven't run out of items
+	// add the items to the cache to get to capacity if they aren't there
+	// already
+	index := 0
+	for ; uint64(misses) < cacheSize && index < len(items); index++ {
+		key := items[index]
+		res, _ := cache[key]
+		if res == true {
+			hits++
+			continue
+		}
+
+		cache[key] = true
+		misses++
+	}
+
+	for ; index < len(items); index++ {
+		nextToAdd := items[index]
+		nextToRemove := ""
+		val := cache[nextToAdd]
+		if val == true {
+			// found
+			hits++
+		} else {
+			// not found, remove the furthest item and return the closest
+			nextToRemove = furthestFunc(index, &cache, &items)
+			if nextToRemove != nextToAdd && nextToRemove != "" {
+				cache[nextToAdd] = true
+				cache[nextToRemove] = false
+			}
+			misses++
+		}
+
+	}
+
+
+	// avoid division errors
+	if misses == 0 {
+		return 1
+	}
+
+	// calculate the result
+	algorithmHitMissRatio := float64(hits) / float64(misses+hits)
+	return algorithmHitMissRatio
+}
+
+// This function will find the cache items that are going to be replaced farthest
+// in the future
+func furthestFunc(tmpIndex int, cache *map[string]bool, items *[]string) string {
+
+	// Holds all the items in the cache
+	cacheCopy := make(map[string]bool)
+	for key, held := range *cache {
+		if held == true {
+			cacheCopy[key] = true
+		}
+	}
+
+	// scan the list of items, removing each until we reach the end of the
+	// list, or we get the item used farthest in the future.
+	for ; tmpIndex < len(*items) && len(cacheCopy) > 1; tmpIndex++ {
+		usedItem := (*items)[tmpIndex]
+		delete(cacheCopy, usedItem)
+	}
+
+	furthestKey := ""
+
+	// Return an item in the map
+	for k, _ := range cacheCopy {
+		furthestKey = k
+		break
+	}
+
+	return furthestKey
+}
@@ -0,0 +1,337 @@
+package multicache
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+var (
+	EntryTooLargeError = errors.New("Value and keys don't fit in a cache slot")
+)
+
+// Size of each preallocated arena, slots never straddle two arenas.
+const byteArenaSize = 64 << 20
+
+/**
+ByteMulticache is a Multicache for []byte values that the garbage collector
+doesn't have to scan. Every slot gets a fixed number of bytes in large
+preallocated arenas holding the value followed by its keys, and keys are
+found through a map from their hash to the slot, so none of the cache's memory
+holds pointers however many items it stores.
+
+Items may have many keys like in a Multicache, and AddMany, Remove and the
+replacement of items behave the same way. Replacement algorithms must be
+written for ReplacementAlgorithmV2, such as LRUPolicy or SecondChancePolicy.
+
+Values are copied in on Add and out on Get.
+**/
+type ByteMulticache struct {
+	lock            sync.RWMutex
+	policy          ReplacementAlgorithmV2
+	retrieveUpdates bool
+
+	// Hash of each key to the slot holding it. Two keys with the same hash
+	// can't both be cached, the newer one wins.
+	index map[uint64]uint32
+	slots []byteSlot
+
+	slotBytes     int
+	slotsPerArena int
+	arenas        [][]byte
+
+	// Emptied slots to fill before asking for a victim, see Multicache.
+	freeSlots []Slot
+}
+
+// Where a slot's value ends and how many keys follow it.
+type byteSlot struct {
+	valueLength uint32
+	keysLength  uint32
+	// 0 while the slot is empty
+	keyCount uint32
+	// True while the slot is empty and on the free list
+	free bool
+}
+
+/**
+Creates a ByteMulticache with numItems slots of slotBytes bytes each. An
+item's value and keys must fit in a slot, each key taking its length plus one
+or two bytes.
+**/
+func NewByteMulticache(numItems uint64, slotBytes int, algorithm ReplacementAlgorithmV2) (*ByteMulticache, error) {
+	if numItems == 0 || slotBytes <= 0 {
+		return nil, InvalidSizeError
+	}
+
+	var bc ByteMulticache
+	bc.policy = algorithm
+	bc.retrieveUpdates = algorithm.UpdatesOnAccess()
+	bc.slots = make([]byteSlot, numItems)
+	bc.slotBytes = slotBytes
+
+	bc.slotsPerArena = byteArenaSize / slotBytes
+	if bc.slotsPerArena == 0 {
+		bc.slotsPerArena = 1
+	}
+
+	for remaining := numItems; remaining > 0; {
+		count := uint64(bc.slotsPerArena)
+		if remaining < count {
+			count = remaining
+		}
+
+		bc.arenas = append(bc.arenas, make([]byte, count*uint64(slotBytes)))
+		remaining -= count
+	}
+
+	bc.Purge()
+	return &bc, nil
+}
+
+// Adds a copy of value to the cache with the given key
+func (bc *ByteMulticache) Add(key string, value []byte) error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	return bc.add(value, key)
+}
+
+/* Adds a copy of value to the cache with the given keys
+
+NOTE: do not include duplicate keys in AddMany, like Multicache.AddMany.
+*/
+func (bc *ByteMulticache) AddMany(value []byte, keys ...string) error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	return bc.add(value, keys...)
+}
+
+func (bc *ByteMulticache) add(value []byte, keys ...string) error {
+	// Do nothing on empty key
+	if len(keys) == 0 {
+		return nil
+	}
+
+	size := len(value)
+	for _, key := range keys {
+		size += uvarintLength(len(key)) + len(key)
+	}
+
+	if size > bc.slotBytes {
+		return EntryTooLargeError
+	}
+
+	slot := bc.getSlot()
+
+	for _, key := range keys {
+		hash := hashKey(key)
+
+		// Remove old references if they exist.
+		if old, ok := bc.index[hash]; ok && bc.slotHasKey(Slot(old), key) {
+			bc.removeSlot(Slot(old), RemoveOverwritten)
+		}
+
+		bc.index[hash] = uint32(slot)
+	}
+
+	region := bc.region(slot)
+	offset := copy(region, value)
+	for _, key := range keys {
+		offset += binary.PutUvarint(region[offset:], uint64(len(key)))
+		offset += copy(region[offset:], key)
+	}
+
+	bc.slots[slot] = byteSlot{
+		valueLength: uint32(len(value)),
+		keysLength:  uint32(offset - len(value)),
+		keyCount:    uint32(len(keys)),
+	}
+
+	bc.policy.OnInsert(slot, keys)
+	return nil
+}
+
+// Fetches a copy of an item's value from the cache
+func (bc *ByteMulticache) Get(key string) (value []byte, ok bool) {
+	return bc.GetInto(nil, key)
+}
+
+// Like Get but appends the value to dst, so a reused buffer saves allocating.
+func (bc *ByteMulticache) GetInto(dst []byte, key string) (value []byte, ok bool) {
+	// If the caching algorithm updates some state when a get is done
+	// do a normal lock, otherwise do a multiple reader lock for speed.
+	if bc.retrieveUpdates {
+		bc.lock.Lock()
+		defer bc.lock.Unlock()
+	} else {
+		bc.lock.RLock()
+		defer bc.lock.RUnlock()
+	}
+
+	slot, ok := bc.find(key)
+	if !ok || !bc.policy.OnAccess(slot) {
+		return dst, false
+	}
+
+	return append(dst, bc.region(slot)[:bc.slots[slot].valueLength]...), true
+}
+
+// Removes an item from the cache
+func (bc *ByteMulticache) Remove(key string) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	if slot, ok := bc.find(key); ok {
+		bc.removeSlot(slot, RemoveExplicit)
+	}
+}
+
+// Removes all items from the cache.
+func (bc *ByteMulticache) Purge() {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.index = make(map[uint64]uint32)
+	bc.freeSlots = bc.freeSlots[:0]
+	for slot := range bc.slots {
+		bc.slots[slot] = byteSlot{}
+	}
+
+	bc.policy.Reset(len(bc.slots))
+}
+
+// Returns the maximum number of items the cache can hold.
+func (bc *ByteMulticache) Capacity() uint64 {
+	return uint64(len(bc.slots))
+}
+
+// Returns the number of items currently stored in the cache. An item added
+// with several keys counts once.
+func (bc *ByteMulticache) Len() int {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	count := 0
+	for _, slot := range bc.slots {
+		if slot.keyCount > 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+// The bytes of the arena belonging to slot.
+func (bc *ByteMulticache) region(slot Slot) []byte {
+	arena := bc.arenas[int(slot)/bc.slotsPerArena]
+	start := (int(slot) % bc.slotsPerArena) * bc.slotBytes
+	return arena[start : start+bc.slotBytes]
+}
+
+// Finds the slot holding key.
+func (bc *ByteMulticache) find(key string) (slot Slot, ok bool) {
+	index, ok := bc.index[hashKey(key)]
+	if !ok || !bc.slotHasKey(Slot(index), key) {
+		return 0, false
+	}
+
+	return Slot(index), true
+}
+
+// True if key is one of the keys stored in slot, ruling out hash collisions.
+func (bc *ByteMulticache) slotHasKey(slot Slot, key string) bool {
+	keys := bc.keys(slot)
+	for i := uint32(0); i < bc.slots[slot].keyCount; i++ {
+		var stored []byte
+		stored, keys = nextKey(keys)
+
+		if string(stored) == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The encoded keys stored in slot, read them with nextKey.
+func (bc *ByteMulticache) keys(slot Slot) []byte {
+	meta := bc.slots[slot]
+	return bc.region(slot)[meta.valueLength : meta.valueLength+meta.keysLength]
+}
+
+// Splits the first key off the encoded keys.
+func nextKey(keys []byte) (key, rest []byte) {
+	length, n := binary.Uvarint(keys)
+	end := n + int(length)
+	return keys[n:end], keys[end:]
+}
+
+// Removes the item in slot, telling the algorithm why if there was one.
+func (bc *ByteMulticache) removeSlot(slot Slot, reason RemoveReason) {
+	if bc.slots[slot].keyCount == 0 {
+		return
+	}
+
+	// Remove the references to this slot, a colliding key may have
+	// replaced some already.
+	keys := bc.keys(slot)
+	for i := uint32(0); i < bc.slots[slot].keyCount; i++ {
+		var key []byte
+		key, keys = nextKey(keys)
+
+		hash := hashKey(key)
+		if index, ok := bc.index[hash]; ok && index == uint32(slot) {
+			delete(bc.index, hash)
+		}
+	}
+
+	bc.policy.OnRemove(slot, reason)
+	bc.slots[slot] = byteSlot{}
+
+	// Evicted slots are filled straight away, others are free to reuse.
+	if reason != RemoveEvicted {
+		bc.slots[slot].free = true
+		bc.freeSlots = append(bc.freeSlots, slot)
+	}
+}
+
+// Picks an empty slot to fill like Multicache.getItem.
+func (bc *ByteMulticache) getSlot() Slot {
+	for len(bc.freeSlots) > 0 {
+		slot := bc.freeSlots[len(bc.freeSlots)-1]
+		bc.freeSlots = bc.freeSlots[:len(bc.freeSlots)-1]
+
+		// Skip slots the algorithm has chosen since they were freed
+		if bc.slots[slot].free {
+			bc.slots[slot].free = false
+			return slot
+		}
+	}
+
+	slot := bc.policy.Victim()
+	bc.slots[slot].free = false
+	bc.removeSlot(slot, RemoveEvicted)
+
+	return slot
+}
+
+// Bytes binary.PutUvarint uses for n.
+func uvarintLength(n int) int {
+	length := 1
+	for n >= 0x80 {
+		n >>= 7
+		length++
+	}
+
+	return length
+}
@@ -0,0 +1,194 @@
+package multicache
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func TestByteMulticache(t *testing.T) {
+	bc, err := NewByteMulticache(2, 32, &LRUPolicy{})
+	assert(t, err == nil, "Cache not created")
+
+	value := []byte("value")
+	bc.Add("a", value)
+	value[0] = 'X'
+
+	got, ok := bc.Get("a")
+	assert(t, ok && string(got) == "value", "Value not copied in")
+
+	got[0] = 'Y'
+	got, _ = bc.Get("a")
+	assert(t, string(got) == "value", "Value not copied out")
+
+	bc.AddMany([]byte("shared"), "b", "c")
+	got, ok = bc.Get("c")
+	assert(t, ok && string(got) == "shared", "Alias missing")
+	assert(t, bc.Len() == 2, "Alias stored twice")
+
+	// a is least recently used
+	bc.Add("d", []byte("new"))
+	_, ok = bc.Get("a")
+	assert(t, !ok, "LRU item kept")
+
+	// Removing one key removes the item for all its keys
+	bc.Remove("b")
+	_, ok = bc.Get("c")
+	assert(t, !ok, "Alias kept after removal")
+
+	bc.Purge()
+	assert(t, bc.Len() == 0, "Purge left items")
+	assert(t, bc.Capacity() == 2, "Wrong capacity")
+}
+
+func TestByteMulticacheOverwrite(t *testing.T) {
+	bc, _ := NewByteMulticache(3, 32, &RoundRobinPolicy{})
+	bc.AddMany([]byte("1"), "a", "b")
+	bc.Add("c", []byte("2"))
+
+	// Takes b from the first item, which is dropped along with a
+	bc.AddMany([]byte("3"), "b", "d")
+	_, ok := bc.Get("a")
+	assert(t, !ok, "Overwritten item kept")
+
+	got, _ := bc.Get("b")
+	assert(t, string(got) == "3", "Key not overwritten")
+
+	// The freed slot is used before anything is evicted
+	bc.Add("e", []byte("4"))
+	_, ok = bc.Get("c")
+	assert(t, ok && bc.Len() == 3, "Item evicted while a slot was free")
+}
+
+func TestByteMulticacheSizes(t *testing.T) {
+	_, err := NewByteMulticache(0, 32, &LRUPolicy{})
+	assert(t, err == InvalidSizeError, "Empty cache created")
+
+	_, err = NewByteMulticache(2, 0, &LRUPolicy{})
+	assert(t, err == InvalidSizeError, "Cache with empty slots created")
+
+	bc, _ := NewByteMulticache(2, 8, &LRUPolicy{})
+
+	// Six value bytes and two for the key
+	assert(t, bc.Add("k", []byte("123456")) == nil, "Full slot rejected")
+	assert(t, bc.Add("k", []byte("1234567")) == EntryTooLargeError, "Oversized item accepted")
+	assert(t, bc.AddMany([]byte("1234"), "k", "l", "m") == EntryTooLargeError, "Oversized keys accepted")
+
+	got, _ := bc.Get("k")
+	assert(t, string(got) == "123456", "Rejected item replaced the old one")
+
+	// Empty values are fine
+	bc.Add("empty", nil)
+	got, ok := bc.Get("empty")
+	assert(t, ok && len(got) == 0, "Empty value missing")
+}
+
+func TestByteMulticacheArenas(t *testing.T) {
+	// Slots bigger than an arena get one each
+	bc, _ := NewByteMulticache(3, byteArenaSize/2+1, &RoundRobinPolicy{})
+	assert(t, len(bc.arenas) == 3, "Slots share arenas")
+
+	for i := 0; i < 3; i++ {
+		key := strconv.Itoa(i)
+		bc.Add(key, bytes.Repeat([]byte(key), 1000))
+	}
+
+	for i := 0; i < 3; i++ {
+		key := strconv.Itoa(i)
+		got, ok := bc.Get(key)
+		assert(t, ok && bytes.Equal(got, bytes.Repeat([]byte(key), 1000)), "Wrong value in arena")
+	}
+}
+
+func TestByteMulticacheHashCollision(t *testing.T) {
+	bc, _ := NewByteMulticache(2, 32, &RoundRobinPolicy{})
+	bc.Add("a", []byte("1"))
+	bc.Add("b", []byte("2"))
+
+	// Pretend b hashes like a, a becomes unreachable but b's item stays
+	bc.index[hashKey("a")] = bc.index[hashKey("b")]
+	_, ok := bc.Get("a")
+	assert(t, !ok, "Colliding key returned another item")
+
+	bc.Remove("a")
+	_, ok = bc.Get("b")
+	assert(t, ok, "Removing a missing key removed another item")
+}
+
+func TestByteMulticacheGetIntoAllocs(t *testing.T) {
+	bc, _ := NewByteMulticache(4, 64, &SecondChancePolicy{})
+	bc.AddMany([]byte("some value"), "key", "alias")
+
+	buffer := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buffer, _ = bc.GetInto(buffer[:0], "alias")
+	})
+
+	assert(t, allocs == 0, "GetInto allocated")
+	assert(t, string(buffer) == "some value", "Wrong value")
+}
+
+func TestByteMulticacheParallel(t *testing.T) {
+	const goroutines, operations, keys = 16, 1000, 64
+
+	for _, policy := range []ReplacementAlgorithmV2{&LRUPolicy{}, &SecondChancePolicy{}, &RandomPolicy{}} {
+		bc, _ := NewByteMulticache(keys/4, 16, policy)
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+
+				var buffer []byte
+				for i := 0; i < operations; i++ {
+					key := strconv.Itoa((i*7 + g) % keys)
+
+					var ok bool
+					buffer, ok = bc.GetInto(buffer[:0], key)
+					if ok && string(buffer) != key {
+						t.Error("Wrong value for", key)
+						return
+					}
+
+					if !ok {
+						bc.AddMany([]byte(key), key, "alias"+key)
+					}
+
+					if i%50 == 0 {
+						bc.Remove(key)
+					}
+				}
+			}(g)
+		}
+
+		wg.Wait()
+	}
+}
+
+func BenchmarkByteMulticacheGet(b *testing.B) {
+	bc, _ := NewByteMulticache(64, 64, &SecondChancePolicy{})
+	keys := make([]string, 64)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		bc.Add(keys[i], []byte(keys[i]))
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		var buffer []byte
+		i := 0
+		for pb.Next() {
+			buffer, _ = bc.GetInto(buffer[:0], keys[i%64])
+			i++
+		}
+	})
+}
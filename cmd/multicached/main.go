@@ -0,0 +1,82 @@
+package main
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+multicached hosts a Multicache and serves it over HTTP so programs that
+aren't written in Go can share it. See server.HTTPHandler for the routes.
+
+Passing -memcached or -resp also serves the same cache to memcached or Redis
+clients.
+**/
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/josephlewis42/multicache"
+	"github.com/josephlewis42/multicache/server"
+)
+
+var (
+	listenAddr    = flag.String("http", "localhost:8080", "address to serve HTTP on")
+	memcachedAddr = flag.String("memcached", "", "address to serve the memcached protocol on, disabled if empty")
+	respAddr      = flag.String("resp", "", "address to serve the Redis protocol on, disabled if empty")
+	cacheSize     = flag.Uint64("size", 1000, "number of items the cache can hold")
+	algorithm     = flag.String("algorithm", "second-chance", "replacement algorithm spec, e.g. lru or timed:expire=1m, one of: "+strings.Join(multicache.AlgorithmNames(), ", "))
+	expireMs      = flag.Int64("expire-ms", 60000, "item lifetime in milliseconds for the timed algorithm when -algorithm doesn't give one")
+	maxValueSize  = flag.Int64("max-value-size", server.DefaultMaxValueSize, "largest value in bytes a client may store over HTTP or the Redis protocol")
+)
+
+func main() {
+	flag.Parse()
+
+	spec := *algorithm
+	if spec == "timed" {
+		spec = fmt.Sprintf("timed:expire=%dms", *expireMs)
+	}
+
+	alg, err := multicache.NewAlgorithm(spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cache, err := multicache.NewMulticache(*cacheSize, alg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	store := server.NewStore(cache)
+
+	if *memcachedAddr != "" {
+		go func() {
+			log.Printf("serving memcached protocol on %s", *memcachedAddr)
+			log.Fatal(server.NewMemcachedServer(store).ListenAndServe(*memcachedAddr))
+		}()
+	}
+
+	if *respAddr != "" {
+		go func() {
+			log.Printf("serving Redis protocol on %s", *respAddr)
+			resp := server.NewRESPServer(store)
+			resp.MaxValueSize = int(*maxValueSize)
+			log.Fatal(resp.ListenAndServe(*respAddr))
+		}()
+	}
+
+	handler := server.NewHTTPHandler(store)
+	handler.MaxValueSize = *maxValueSize
+
+	log.Printf("serving a %d item %s cache on http://%s", *cacheSize, *algorithm, *listenAddr)
+	log.Fatal(http.ListenAndServe(*listenAddr, handler))
+}
@@ -0,0 +1,249 @@
+package main
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+speedtest measures how many Gets and Adds per second each replacement
+algorithm manages on a synthetic workload with 1 up to -threads goroutines,
+along with the hit ratio it achieves.
+
+Save a run with -format json and pass it to a later run with -baseline to
+flag algorithms that have slowed down by more than -threshold.
+**/
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/josephlewis42/multicache"
+	"github.com/josephlewis42/multicache/harness"
+	"github.com/josephlewis42/multicache/workload"
+)
+
+var (
+	cacheSize  = flag.Uint64("size", 3, "number of items the cache can hold")
+	requests   = flag.Int("requests", 10000, "number of requests in the workload, they're repeated as needed")
+	keys       = flag.Int("keys", 15, "number of distinct keys in the workload")
+	maxThreads = flag.Int("threads", 8, "run with 1 up to this many threads")
+	algorithms = flag.String("algorithms", "lru,approx-lru,random,round-robin,second-chance,sieve,timed:expire=1s", "comma separated algorithm specs to test")
+
+	workloadName = flag.String("workload", "repeat", "workload: repeat, uniform, zipf, scan, shifting or loop")
+	seed         = flag.Int64("seed", 1, "seed for the workload")
+	repeatChance = flag.Float64("repeat-chance", 0.8, "repeat workload: chance of repeating a recent key")
+	skew         = flag.Float64("skew", 0.99, "zipf workload: skew of the key popularity")
+	hotKeys      = flag.Int("hot-keys", 0, "scan and shifting workloads: size of the hot set, defaults to the cache size")
+	hotChance    = flag.Float64("hot-chance", 0.9, "shifting workload: chance of requesting a hot key")
+	shiftEvery   = flag.Int("shift-every", 1000, "shifting workload: requests between hot set shifts")
+	scanLength   = flag.Int("scan-length", 100, "scan workload: keys read by each scan")
+	scanChance   = flag.Float64("scan-chance", 0.01, "scan workload: chance of starting a scan")
+	aliases      = flag.Int("aliases", 1, "give each item up to this many keys, added together with AddMany")
+
+	latency = flag.Bool("latency", false, "measure latency percentiles and lock wait with the harness, -requests is per thread")
+	mix     = flag.String("mix", harness.DefaultMix.String(), "latency mode: weights of get, add, addmany, remove and getorfind")
+
+	format    = flag.String("format", "text", "output format: text, json or csv")
+	baseline  = flag.String("baseline", "", "JSON output of an earlier run to compare against")
+	threshold = flag.Float64("threshold", 0.1, "fraction ops/sec may drop below the baseline before it's a regression")
+)
+
+func main() {
+	flag.Parse()
+
+	generator, err := newGenerator(*seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	algs, err := multicache.ParseAlgorithmList(*algorithms)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opMix, err := harness.ParseMix(*mix)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data := workload.Requests(generator, *requests)
+	run := Run{Config: currentConfig()}
+
+	for _, alg := range algs {
+		if *latency {
+			run.Results = append(run.Results, measureLatency(alg, opMix)...)
+			continue
+		}
+
+		hitRatio, _ := multicache.CalculateHitMissTrace(requestTrace(data), *cacheSize, alg.New())
+
+		for threads := 1; threads <= *maxThreads; threads++ {
+			runtime.GOMAXPROCS(threads)
+			result := testing.Benchmark(benchmarkAlgorithm(data, alg.New, *cacheSize))
+
+			run.Results = append(run.Results, Result{
+				Algorithm:      alg.Name,
+				Threads:        threads,
+				OpsPerSecond:   float64(result.N) / result.T.Seconds(),
+				AllocatedBytes: result.MemBytes,
+				HitRatio:       hitRatio,
+			})
+		}
+	}
+
+	if err := run.Write(os.Stdout, *format); err != nil {
+		log.Fatal(err)
+	}
+
+	if *baseline != "" {
+		previous, err := ReadRun(*baseline)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		comparisons := Compare(previous, run, *threshold)
+		if err := WriteComparison(os.Stderr, previous, run, comparisons); err != nil {
+			log.Fatal(err)
+		}
+
+		if Regressed(comparisons) {
+			os.Exit(1)
+		}
+	}
+}
+
+// Runs the harness with 1 up to -threads goroutines.
+func measureLatency(alg multicache.NamedAlgorithm, opMix harness.Mix) []Result {
+	results := []Result{}
+
+	for threads := 1; threads <= *maxThreads; threads++ {
+		runtime.GOMAXPROCS(threads)
+		measured := harness.Run(harness.Config{
+			CacheSize:  *cacheSize,
+			Goroutines: threads,
+			Operations: *requests,
+			Mix:        opMix,
+			Seed:       *seed,
+			NewGenerator: func(seed int64) workload.Generator {
+				// The flags were checked when the first generator was made
+				generator, _ := newGenerator(seed)
+				return generator
+			},
+		}, alg)
+
+		results = append(results, Result{
+			Algorithm:    alg.Name,
+			Threads:      threads,
+			OpsPerSecond: measured.OpsPerSecond,
+			P50Ns:        measured.Latency.P50.Nanoseconds(),
+			P99Ns:        measured.Latency.P99.Nanoseconds(),
+			P999Ns:       measured.Latency.P999.Nanoseconds(),
+			LockWaitNs:   measured.LockWait.Nanoseconds(),
+		})
+	}
+
+	return results
+}
+
+func newGenerator(seed int64) (workload.Generator, error) {
+	hot := *hotKeys
+	if hot <= 0 {
+		hot = int(*cacheSize)
+	}
+
+	var generator workload.Generator
+	switch *workloadName {
+	case "repeat":
+		window := int(*cacheSize) - 1
+		if window < 1 {
+			window = 1
+		}
+		generator = workload.NewRepeatChance(seed, *keys, window, *repeatChance)
+	case "uniform":
+		generator = workload.NewUniform(seed, *keys)
+	case "zipf":
+		generator = workload.NewZipfian(seed, *keys, *skew)
+	case "scan":
+		generator = workload.NewScanHotSet(seed, hot, *keys-hot, *scanLength, *scanChance)
+	case "shifting":
+		generator = workload.NewShiftingHotSet(seed, *keys, hot, *hotChance, *shiftEvery)
+	case "loop":
+		generator = workload.NewLoop(*keys)
+	default:
+		return nil, fmt.Errorf("unknown workload %q", *workloadName)
+	}
+
+	if *aliases > 1 {
+		generator = workload.NewMultiKey(seed, generator, *aliases)
+	}
+
+	return generator, nil
+}
+
+func currentConfig() Config {
+	config := Config{
+		CacheSize: *cacheSize,
+		Requests:  *requests,
+		Keys:      *keys,
+		Workload:  *workloadName,
+		Seed:      *seed,
+		Aliases:   *aliases,
+	}
+
+	if *latency {
+		config.Mix = *mix
+	}
+
+	return config
+}
+
+// Gets every request, adding the item on a miss, spread over the benchmark's
+// goroutines.
+func benchmarkAlgorithm(data []workload.Request, newAlgorithm multicache.AlgorithmFactory, cacheSize uint64) func(b *testing.B) {
+	return func(b *testing.B) {
+		cache, _ := multicache.NewMulticache(cacheSize, newAlgorithm())
+
+		b.RunParallel(func(pb *testing.PB) {
+			n := 0
+			for pb.Next() {
+				request := data[n%len(data)]
+				if _, ok := cache.Get(request.Key); !ok {
+					if len(request.Aliases) > 0 {
+						cache.AddMany(request.Key, request.Aliases...)
+					} else {
+						cache.Add(request.Key, request.Key)
+					}
+				}
+				n++
+			}
+		})
+	}
+}
+
+func requestTrace(data []workload.Request) multicache.TraceReader {
+	events := make([]multicache.TraceEvent, len(data))
+	for i, request := range data {
+		keys := []string{request.Key}
+		for _, alias := range request.Aliases {
+			if alias != request.Key {
+				keys = append(keys, alias)
+			}
+		}
+
+		events[i] = multicache.TraceEvent{Op: multicache.TraceGet, Keys: keys}
+	}
+
+	return multicache.NewEventTraceReader(events)
+}
@@ -0,0 +1,218 @@
+package main
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// The parameters of a run, comparisons are only meaningful between runs with
+// the same config.
+type Config struct {
+	CacheSize uint64 `json:"cache_size"`
+	Requests  int    `json:"requests"`
+	Keys      int    `json:"keys"`
+	Workload  string `json:"workload"`
+	Seed      int64  `json:"seed"`
+	Aliases   int    `json:"aliases"`
+	// The operation mix of latency runs
+	Mix string `json:"mix,omitempty"`
+}
+
+// How one algorithm did with a number of threads.
+type Result struct {
+	Algorithm      string  `json:"algorithm"`
+	Threads        int     `json:"threads"`
+	OpsPerSecond   float64 `json:"ops_per_second"`
+	AllocatedBytes uint64  `json:"allocated_bytes"`
+	HitRatio       float64 `json:"hit_ratio"`
+
+	// Only measured by latency runs
+	P50Ns      int64 `json:"p50_ns,omitempty"`
+	P99Ns      int64 `json:"p99_ns,omitempty"`
+	P999Ns     int64 `json:"p999_ns,omitempty"`
+	LockWaitNs int64 `json:"lock_wait_ns,omitempty"`
+}
+
+type Run struct {
+	Config  Config   `json:"config"`
+	Results []Result `json:"results"`
+}
+
+// Reads a run saved with -format json.
+func ReadRun(path string) (Run, error) {
+	var run Run
+
+	file, err := os.Open(path)
+	if err != nil {
+		return run, err
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(&run)
+	return run, err
+}
+
+// Writes the run as text, json or csv.
+func (run Run) Write(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		return run.writeText(w)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(run)
+	case "csv":
+		return run.writeCSV(w)
+	}
+
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func (run Run) writeText(w io.Writer) error {
+	threads := 0
+	for _, result := range run.Results {
+		if result.Threads < threads {
+			fmt.Fprintln(w)
+		}
+		threads = result.Threads
+
+		if run.Config.Mix != "" {
+			fmt.Fprintf(w, "%-15s Threads: %2d Operations/Second: %9.0f p50: %6dns p99: %7dns p999: %8dns Lock wait: %v\n",
+				result.Algorithm,
+				result.Threads,
+				result.OpsPerSecond,
+				result.P50Ns,
+				result.P99Ns,
+				result.P999Ns,
+				time.Duration(result.LockWaitNs))
+			continue
+		}
+
+		fmt.Fprintf(w, "%-15s Threads: %2d Allocated: %5d kB Operations/Second: %9.0f Hit %%: %6.2f\n",
+			result.Algorithm,
+			result.Threads,
+			result.AllocatedBytes/1024,
+			result.OpsPerSecond,
+			result.HitRatio*100)
+	}
+
+	return nil
+}
+
+func (run Run) writeCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"algorithm", "threads", "ops_per_second", "allocated_bytes", "hit_ratio", "p50_ns", "p99_ns", "p999_ns", "lock_wait_ns"})
+
+	for _, result := range run.Results {
+		out.Write([]string{
+			result.Algorithm,
+			strconv.Itoa(result.Threads),
+			strconv.FormatFloat(result.OpsPerSecond, 'f', 0, 64),
+			strconv.FormatUint(result.AllocatedBytes, 10),
+			strconv.FormatFloat(result.HitRatio, 'f', -1, 64),
+			strconv.FormatInt(result.P50Ns, 10),
+			strconv.FormatInt(result.P99Ns, 10),
+			strconv.FormatInt(result.P999Ns, 10),
+			strconv.FormatInt(result.LockWaitNs, 10),
+		})
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// A result and the baseline result with the same algorithm and threads.
+type Comparison struct {
+	Current  Result
+	Baseline Result
+	// Relative change in ops/sec, -0.2 is 20% slower
+	Change    float64
+	Regressed bool
+}
+
+/**
+Pairs the results of current with those of baseline. Results are regressions
+when their ops/sec fell by more than threshold, a fraction of the baseline's.
+Results missing from the baseline are skipped.
+**/
+func Compare(baseline, current Run, threshold float64) []Comparison {
+	type resultKey struct {
+		algorithm string
+		threads   int
+	}
+
+	previous := make(map[resultKey]Result)
+	for _, result := range baseline.Results {
+		previous[resultKey{result.Algorithm, result.Threads}] = result
+	}
+
+	comparisons := []Comparison{}
+	for _, result := range current.Results {
+		base, ok := previous[resultKey{result.Algorithm, result.Threads}]
+		if !ok || base.OpsPerSecond <= 0 {
+			continue
+		}
+
+		change := (result.OpsPerSecond - base.OpsPerSecond) / base.OpsPerSecond
+		comparisons = append(comparisons, Comparison{
+			Current:   result,
+			Baseline:  base,
+			Change:    change,
+			Regressed: change < -threshold,
+		})
+	}
+
+	return comparisons
+}
+
+// Returns true if any comparison is a regression.
+func Regressed(comparisons []Comparison) bool {
+	for _, comparison := range comparisons {
+		if comparison.Regressed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Writes the comparisons as a table, warning if the runs aren't comparable.
+func WriteComparison(w io.Writer, baseline, current Run, comparisons []Comparison) error {
+	if baseline.Config != current.Config {
+		fmt.Fprintf(w, "warning: baseline config %+v differs from %+v\n", baseline.Config, current.Config)
+	}
+
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "Algorithm\tThreads\tBaseline ops/sec\tOps/sec\tChange\t\t")
+
+	for _, comparison := range comparisons {
+		flag := ""
+		if comparison.Regressed {
+			flag = "REGRESSION"
+		}
+
+		fmt.Fprintf(table, "%s\t%d\t%.0f\t%.0f\t%+.1f%%\t%s\t\n",
+			comparison.Current.Algorithm,
+			comparison.Current.Threads,
+			comparison.Baseline.OpsPerSecond,
+			comparison.Current.OpsPerSecond,
+			comparison.Change*100,
+			flag)
+	}
+
+	return table.Flush()
+}
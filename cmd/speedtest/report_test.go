@@ -0,0 +1,65 @@
+package main
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func assert(t *testing.T, assertion bool, errinfo string) {
+	if !assertion {
+		t.Error(errinfo)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := Run{Results: []Result{
+		{Algorithm: "lru", Threads: 1, OpsPerSecond: 1000},
+		{Algorithm: "lru", Threads: 2, OpsPerSecond: 1000},
+		{Algorithm: "random", Threads: 1, OpsPerSecond: 1000},
+	}}
+	current := Run{Results: []Result{
+		{Algorithm: "lru", Threads: 1, OpsPerSecond: 950},
+		{Algorithm: "lru", Threads: 2, OpsPerSecond: 800},
+		{Algorithm: "second-chance", Threads: 1, OpsPerSecond: 10},
+	}}
+
+	comparisons := Compare(baseline, current, 0.1)
+	assert(t, len(comparisons) == 2, "Results missing from the baseline should be skipped")
+	assert(t, !comparisons[0].Regressed && comparisons[1].Regressed, "Wrong regressions flagged")
+	assert(t, Regressed(comparisons), "Regression not reported")
+	assert(t, !Regressed(comparisons[:1]), "Regression reported")
+
+	var out bytes.Buffer
+	WriteComparison(&out, baseline, current, comparisons)
+	assert(t, strings.Count(out.String(), "REGRESSION") == 1, "Unexpected comparison: "+out.String())
+}
+
+func TestWriteRun(t *testing.T) {
+	run := Run{
+		Config:  Config{CacheSize: 3, Workload: "zipf"},
+		Results: []Result{{Algorithm: "lru", Threads: 1, OpsPerSecond: 1234.5, AllocatedBytes: 2048, HitRatio: 0.5}},
+	}
+
+	var out bytes.Buffer
+	assert(t, run.Write(&out, "json") == nil, "JSON failed")
+
+	var decoded Run
+	json.Unmarshal(out.Bytes(), &decoded)
+	assert(t, decoded.Config == run.Config && decoded.Results[0] == run.Results[0], "JSON didn't round trip")
+
+	out.Reset()
+	run.Write(&out, "csv")
+	assert(t, out.String() == "algorithm,threads,ops_per_second,allocated_bytes,hit_ratio,p50_ns,p99_ns,p999_ns,lock_wait_ns\nlru,1,1234,2048,0.5,0,0,0,0\n", "Unexpected CSV: "+out.String())
+
+	assert(t, run.Write(&out, "xml") != nil, "Unknown format accepted")
+}
@@ -0,0 +1,131 @@
+package multicache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Run with -race, these hammer caches from many goroutines so the race detector
+can catch algorithms that aren't safe under the locks they ask for.
+**/
+
+func TestConcurrentRetrieverLocking(t *testing.T) {
+	testcases := []struct {
+		algorithm ReplacementAlgorithm
+		writeLock bool
+	}{
+		{&SecondChance{}, false},
+		{&Sieve{}, false},
+		{&ApproximateLRU{}, false},
+		{&LeastRecentlyUsed{}, true},
+		{&RoundRobin{}, false},
+	}
+
+	for _, testcase := range testcases {
+		mc, _ := NewMulticache(10, testcase.algorithm)
+		assert(t, mc.retrieveUpdates == testcase.writeLock, "Get takes the wrong lock")
+	}
+}
+
+func TestParallelGetAdd(t *testing.T) {
+	const goroutines, operations, keys = 16, 2000, 64
+
+	for _, algorithm := range RegisteredAlgorithms() {
+		mc, _ := NewMulticache(keys/4, algorithm.New())
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+
+				for i := 0; i < operations; i++ {
+					key := strconv.Itoa((i*7 + g) % keys)
+
+					// Mostly Gets so readers overlap
+					value, ok := mc.Get(key)
+					if ok && value != key {
+						t.Error(algorithm.Name, "returned the wrong value for", key)
+						return
+					}
+
+					if !ok || i%10 == 0 {
+						mc.AddMany(key, key, key+"/alias")
+					}
+
+					if i%50 == 0 {
+						mc.Remove(key)
+					}
+				}
+			}(g)
+		}
+
+		wg.Wait()
+
+		// Every key still maps to the item holding it
+		for key, item := range mc.kvStore {
+			assert(t, containsString(item.keys, key), algorithm.Name+" key points at an item that doesn't hold it")
+		}
+	}
+}
+
+func TestParallelGetOnly(t *testing.T) {
+	const goroutines, operations = 16, 5000
+
+	for _, algorithm := range []ReplacementAlgorithm{&SecondChance{}, &ApproximateLRU{}} {
+		mc, _ := NewMulticache(8, algorithm)
+		for i := 0; i < 8; i++ {
+			mc.Add(strconv.Itoa(i), i)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+
+				for i := 0; i < operations; i++ {
+					key := (i + g) % 8
+					value, ok := mc.Get(strconv.Itoa(key))
+					if !ok || value != key {
+						t.Error("Item lost without any Adds")
+						return
+					}
+				}
+			}(g)
+		}
+
+		wg.Wait()
+	}
+}
+
+func BenchmarkParallelGet(b *testing.B) {
+	for _, algorithm := range []NamedAlgorithm{
+		{"lru", func() ReplacementAlgorithm { return &LeastRecentlyUsed{} }},
+		{"approx-lru", func() ReplacementAlgorithm { return &ApproximateLRU{} }},
+		{"second-chance", func() ReplacementAlgorithm { return &SecondChance{} }},
+	} {
+		b.Run(algorithm.Name, func(b *testing.B) {
+			mc, _ := NewMulticache(64, algorithm.New())
+			for i := 0; i < 64; i++ {
+				mc.Add(strconv.Itoa(i), i)
+			}
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					mc.Get(strconv.Itoa(i % 64))
+					i++
+				}
+			})
+		})
+	}
+}
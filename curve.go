@@ -0,0 +1,195 @@
+package multicache
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Hit ratio curves show how the hit ratio of an algorithm changes with the size
+of the cache, so a cache can be sized without calling CalculateHitMiss once
+per size.
+**/
+
+// Creates a fresh ReplacementAlgorithm, algorithms hold state so each cache
+// needs its own.
+type AlgorithmFactory func() ReplacementAlgorithm
+
+// The hit ratio of a cache holding CacheSize items.
+type CurvePoint struct {
+	CacheSize uint64
+	HitRatio  float64
+}
+
+// Points for every cache size from 1 upwards, in order.
+type HitRatioCurve []CurvePoint
+
+/**
+Calculates the LRU hit ratio of items for every cache size up to maxSize in a
+single pass using Mattson's stack distance: an item that was last used d
+distinct items ago hits in every LRU cache holding at least d items.
+
+A maxSize of 0 calculates sizes up to the number of distinct items, where the
+curve stops changing. Runs in O(n log n).
+**/
+func CalculateLRUCurve(items []string, maxSize uint64) HitRatioCurve {
+	// Marks the last use of every item so the distinct items used between two
+	// indices can be counted.
+	marks := newFenwickTree(len(items))
+	lastUse := make(map[string]int)
+	hitsAtDistance := make([]int, len(items)+1)
+
+	for index, item := range items {
+		if last, ok := lastUse[item]; ok {
+			distance := marks.sum(index) - marks.sum(last+1) + 1
+			hitsAtDistance[distance]++
+			marks.add(last, -1)
+		}
+
+		marks.add(index, 1)
+		lastUse[item] = index
+	}
+
+	if maxSize == 0 {
+		maxSize = uint64(len(lastUse))
+	}
+
+	curve := make(HitRatioCurve, maxSize)
+	hits := 0
+	for size := uint64(1); size <= maxSize; size++ {
+		if size < uint64(len(hitsAtDistance)) {
+			hits += hitsAtDistance[size]
+		}
+
+		curve[size-1] = CurvePoint{size, ratioOf(hits, len(items))}
+	}
+
+	return curve
+}
+
+/**
+Approximates the hit ratio curve of any algorithm using SHARDS (Waldspurger et
+al.): only items whose key hashes below sampleRate are simulated, in caches
+scaled down by the same rate. Every scaled cache is fed from the same pass over
+the sample and sizes that scale to the same cache share it.
+
+A sampleRate of 0.01 simulates about 1% of the keys, which is usually accurate
+to within a percent or two for traces with many distinct keys. A sampleRate of
+1 or more simulates everything and gives exactly what CalculateHitMiss would.
+A maxSize of 0 calculates sizes up to the number of distinct items.
+**/
+func CalculateSampledCurve(items []string, maxSize uint64, newAlgorithm AlgorithmFactory, sampleRate float64) HitRatioCurve {
+	threshold := uint64(math.MaxUint64)
+	if sampleRate < 1 {
+		threshold = uint64(sampleRate * float64(math.MaxUint64))
+	}
+
+	sample := []string{}
+	distinct := make(map[string]bool)
+	for _, item := range items {
+		distinct[item] = true
+		if sampleRate >= 1 || hashKey(item) < threshold {
+			sample = append(sample, item)
+		}
+	}
+
+	if maxSize == 0 {
+		maxSize = uint64(len(distinct))
+	}
+
+	// Each size simulated by the cache of its scaled size
+	caches := make(map[uint64]*Multicache)
+	hits := make(map[uint64]int)
+	scaled := make([]uint64, maxSize)
+	for size := uint64(1); size <= maxSize; size++ {
+		scaledSize := size
+		if sampleRate < 1 {
+			scaledSize = uint64(math.Round(float64(size) * sampleRate))
+		}
+
+		scaled[size-1] = scaledSize
+		if _, ok := caches[scaledSize]; !ok && scaledSize > 0 {
+			caches[scaledSize], _ = NewMulticache(scaledSize, newAlgorithm())
+		}
+	}
+
+	for _, item := range sample {
+		for scaledSize, mc := range caches {
+			if _, ok := mc.Get(item); ok {
+				hits[scaledSize]++
+			} else {
+				mc.Add(item, item)
+			}
+		}
+	}
+
+	curve := make(HitRatioCurve, maxSize)
+	for size := uint64(1); size <= maxSize; size++ {
+		curve[size-1] = CurvePoint{size, ratioOf(hits[scaled[size-1]], len(sample))}
+	}
+
+	return curve
+}
+
+/**
+Writes the curve as CSV with the columns
+
+	cache_size,hit_ratio,miss_ratio
+
+so it can be plotted with a spreadsheet or gnuplot.
+**/
+func (c HitRatioCurve) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"cache_size", "hit_ratio", "miss_ratio"})
+
+	for _, point := range c {
+		out.Write([]string{
+			strconv.FormatUint(point.CacheSize, 10),
+			strconv.FormatFloat(point.HitRatio, 'f', -1, 64),
+			strconv.FormatFloat(1-point.HitRatio, 'f', -1, 64),
+		})
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func ratioOf(hits, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(total)
+}
+
+// Counts marks by index, both operations take O(log n).
+type fenwickTree []int
+
+func newFenwickTree(size int) fenwickTree {
+	return make(fenwickTree, size+1)
+}
+
+// Adds delta to the count at index
+func (f fenwickTree) add(index int, delta int) {
+	for i := index + 1; i < len(f); i += i & -i {
+		f[i] += delta
+	}
+}
+
+// Returns the total count of the indices below end
+func (f fenwickTree) sum(end int) int {
+	total := 0
+	for i := end; i > 0; i -= i & -i {
+		total += f[i]
+	}
+
+	return total
+}
@@ -0,0 +1,81 @@
+package multicache
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func randomItems(seed int64, count, keys int) []string {
+	random := rand.New(rand.NewSource(seed))
+	items := make([]string, count)
+	for i := range items {
+		// Squaring skews the keys so small caches get some hits
+		key := random.Float64()
+		items[i] = strconv.Itoa(int(key * key * float64(keys)))
+	}
+
+	return items
+}
+
+func TestLRUCurveMatchesSimulation(t *testing.T) {
+	items := randomItems(1, 500, 40)
+	curve := CalculateLRUCurve(items, 45)
+	assert(t, len(curve) == 45, "Wrong number of points")
+
+	for _, point := range curve {
+		expected := CalculateHitMiss(items, point.CacheSize, &LeastRecentlyUsed{})
+		if math.Abs(point.HitRatio-expected) > 1e-12 {
+			t.Error("Unexpected ratio, size:", point.CacheSize, "result:", point.HitRatio, "expected:", expected)
+		}
+	}
+
+	// Sizes default to the number of distinct items
+	curve = CalculateLRUCurve([]string{"a", "b", "a", "c", "b"}, 0)
+	assert(t, len(curve) == 3, "Default max size wrong")
+	assert(t, curve[0].HitRatio == 0 && curve[1].HitRatio == 0.2 && curve[2].HitRatio == 0.4, "Unexpected small curve")
+}
+
+func TestSampledCurveExact(t *testing.T) {
+	items := randomItems(2, 300, 30)
+	newAlgorithm := func() ReplacementAlgorithm { return &RoundRobin{} }
+
+	for _, point := range CalculateSampledCurve(items, 32, newAlgorithm, 1) {
+		expected := CalculateHitMiss(items, point.CacheSize, &RoundRobin{})
+		if point.HitRatio != expected {
+			t.Error("Unexpected ratio, size:", point.CacheSize, "result:", point.HitRatio, "expected:", expected)
+		}
+	}
+}
+
+func TestSampledCurveApproximatesLRU(t *testing.T) {
+	items := randomItems(3, 50000, 5000)
+	exact := CalculateLRUCurve(items, 2000)
+	sampled := CalculateSampledCurve(items, 2000, func() ReplacementAlgorithm {
+		return &LeastRecentlyUsed{}
+	}, 0.1)
+
+	for _, size := range []int{100, 500, 1000, 2000} {
+		difference := math.Abs(exact[size-1].HitRatio - sampled[size-1].HitRatio)
+		assert(t, difference < 0.05, "Sampled curve too far off at size "+strconv.Itoa(size))
+	}
+}
+
+func TestCurveWriteCSV(t *testing.T) {
+	var out bytes.Buffer
+	curve := HitRatioCurve{{1, 0.25}, {2, 0.5}}
+	err := curve.WriteCSV(&out)
+
+	expected := "cache_size,hit_ratio,miss_ratio\n1,0.25,0.75\n2,0.5,0.5\n"
+	assert(t, err == nil && out.String() == expected, "Unexpected CSV: "+out.String())
+}
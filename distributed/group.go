@@ -0,0 +1,193 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+var (
+	NoLoaderError = errors.New("A loader is required to create a group")
+)
+
+/**
+Loader is called on the owner of a key when the key isn't cached anywhere. It
+works like multicache.GetOrFindMiss: it returns the value for searchKey along
+with every key the value should be reachable through, which must include
+searchKey.
+**/
+type Loader func(searchKey string) (value []byte, keys []string, err error)
+
+// Peer is another process holding part of a Group.
+type Peer interface {
+	// Fetches key from the peer's group, loading it on the peer if needed.
+	// keys holds every key the value is reachable through.
+	Get(ctx context.Context, group, key string) (value []byte, keys []string, err error)
+	// Stores value under keys in the peer's group.
+	Put(ctx context.Context, group string, value []byte, keys []string) error
+}
+
+// PeerPicker chooses the owner of a key.
+type PeerPicker interface {
+	// Returns the peer owning key, or ok false if the local process owns it.
+	PickPeer(key string) (peer Peer, ok bool)
+}
+
+/**
+Group is a cache spread across several processes. Every key has one owner
+chosen by the PeerPicker. The owner keeps the key in its main cache and is the
+only process that calls the Loader for it; other processes fetch the value from
+the owner and keep a copy in a small hot cache.
+
+When a loaded value has several keys that belong to different owners, the
+value is pushed to each of those owners so it can be resolved from any of its
+keys without loading it again.
+**/
+type Group struct {
+	name   string
+	peers  PeerPicker
+	loader Loader
+
+	// Keys owned by this process
+	main *multicache.Multicache
+	// Copies of keys owned by other processes
+	hot *multicache.Multicache
+}
+
+// Creates a group whose main cache holds cacheSize items and hot cache holds
+// hotSize copies of other peers' items. A nil PeerPicker makes a group that
+// owns every key.
+func NewGroup(name string, cacheSize, hotSize uint64, peers PeerPicker, loader Loader) (*Group, error) {
+	if loader == nil {
+		return nil, NoLoaderError
+	}
+
+	main, err := multicache.NewDefaultMulticache(cacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	hot, err := multicache.NewDefaultMulticache(hotSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Group{name: name, peers: peers, loader: loader, main: main, hot: hot}, nil
+}
+
+// Returns the group's name.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Fetches the value for key from wherever it is owned.
+func (g *Group) Get(key string) ([]byte, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// Like Get, but requests to other peers are abandoned once ctx is done.
+func (g *Group) GetContext(ctx context.Context, key string) ([]byte, error) {
+	peer, remote := g.pickPeer(key)
+	if !remote {
+		value, _, err := g.getLocally(ctx, key)
+		return value, err
+	}
+
+	if value, ok := g.hot.Get(key); ok {
+		return value.([]byte), nil
+	}
+
+	value, keys, err := peer.Get(ctx, g.name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	g.hot.AddMany(value, keys...)
+	return value, nil
+}
+
+// Removes key from the local caches, other peers are unaffected.
+func (g *Group) Remove(key string) {
+	g.main.Remove(key)
+	g.hot.Remove(key)
+}
+
+// Looks key up in the main cache, calling the loader on a miss. This is what
+// the owner runs, including when a peer asks it for the key.
+func (g *Group) getLocally(ctx context.Context, key string) ([]byte, []string, error) {
+	loaded := false
+	item, err := g.main.GetOrFind(key, func(searchKey string) (interface{}, []string, error) {
+		v, k, err := g.loader(searchKey)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		loaded = true
+		return &groupValue{v, k}, k, nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gv := item.(*groupValue)
+	if loaded {
+		g.pushToOwners(ctx, gv)
+	}
+
+	return gv.value, gv.keys, nil
+}
+
+// Sends a freshly loaded value to the owners of its other keys.
+func (g *Group) pushToOwners(ctx context.Context, gv *groupValue) {
+	pushed := []Peer{}
+	for _, key := range gv.keys {
+		peer, remote := g.pickPeer(key)
+		if !remote || containsPeer(pushed, peer) {
+			continue
+		}
+
+		// This is best effort, the owner can always load the key itself.
+		peer.Put(ctx, g.name, gv.value, gv.keys)
+		pushed = append(pushed, peer)
+	}
+}
+
+// A group without peers owns every key.
+func (g *Group) pickPeer(key string) (Peer, bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+
+	return g.peers.PickPeer(key)
+}
+
+// Stores a value pushed by a peer.
+func (g *Group) putLocally(value []byte, keys []string) {
+	g.main.AddMany(&groupValue{value, keys}, keys...)
+}
+
+// The main cache remembers every key of a value so it can tell peers.
+type groupValue struct {
+	value []byte
+	keys  []string
+}
+
+func containsPeer(peers []Peer, peer Peer) bool {
+	for _, p := range peers {
+		if p == peer {
+			return true
+		}
+	}
+
+	return false
+}
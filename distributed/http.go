@@ -0,0 +1,272 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+const (
+	// Where an HTTPPool expects to be mounted on each peer
+	DefaultBasePath = "/_multicache/"
+	// Number of points each peer gets on the ring
+	DefaultReplicas = 50
+	// How long a request to a peer may take unless HTTPPoolOptions says otherwise
+	DefaultPeerTimeout = 10 * time.Second
+	// Largest value sent between peers unless HTTPPoolOptions says otherwise
+	DefaultMaxValueSize = 1024 * 1024
+
+	// Carries a value's keys, encoded as a query string
+	keysHeader = "X-Multicache-Keys"
+)
+
+var (
+	ValueTooLargeError = errors.New("Peer sent a value larger than MaxValueSize")
+)
+
+// HTTPPoolOptions tunes an HTTPPool, the zero value uses the defaults.
+type HTTPPoolOptions struct {
+	// Used for requests to peers, a client with DefaultPeerTimeout if nil
+	Client *http.Client
+	// Largest value accepted from a peer, DefaultMaxValueSize if zero
+	MaxValueSize int64
+}
+
+/**
+HTTPPool is a PeerPicker whose peers are other processes reachable over HTTP.
+It is also the http.Handler those peers talk to, so it must be served at
+DefaultBasePath on every peer:
+
+	pool := distributed.NewHTTPPool("http://10.0.0.1:8000")
+	pool.Set("http://10.0.0.1:8000", "http://10.0.0.2:8000")
+	users, _ := pool.NewGroup("users", 1000, 100, loadUser)
+	http.Handle(distributed.DefaultBasePath, pool)
+
+Peers are identified by their base URL and every peer must be given the same
+list so they agree on which peer owns each key.
+**/
+type HTTPPool struct {
+	self         string
+	client       *http.Client
+	maxValueSize int64
+
+	lock   sync.RWMutex
+	ring   *Ring
+	peers  map[string]*httpPeer
+	groups map[string]*Group
+}
+
+// Creates a pool for the process reachable at self, e.g. "http://host:port".
+func NewHTTPPool(self string) *HTTPPool {
+	return NewHTTPPoolOptions(self, nil)
+}
+
+// Like NewHTTPPool, but options may replace the defaults. options may be nil.
+func NewHTTPPoolOptions(self string, options *HTTPPoolOptions) *HTTPPool {
+	pool := &HTTPPool{
+		self:         strings.TrimSuffix(self, "/"),
+		client:       &http.Client{Timeout: DefaultPeerTimeout},
+		maxValueSize: DefaultMaxValueSize,
+		ring:         NewRing(DefaultReplicas, nil),
+		peers:        make(map[string]*httpPeer),
+		groups:       make(map[string]*Group),
+	}
+
+	if options != nil && options.Client != nil {
+		pool.client = options.Client
+	}
+
+	if options != nil && options.MaxValueSize > 0 {
+		pool.maxValueSize = options.MaxValueSize
+	}
+
+	return pool
+}
+
+// Replaces the set of peers, which should include this process.
+func (p *HTTPPool) Set(peers ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.ring = NewRing(DefaultReplicas, nil)
+	p.peers = make(map[string]*httpPeer)
+
+	for _, peer := range peers {
+		peer = strings.TrimSuffix(peer, "/")
+		p.ring.Add(peer)
+		p.peers[peer] = &httpPeer{baseURL: peer + DefaultBasePath, client: p.client, maxValueSize: p.maxValueSize}
+	}
+}
+
+// Creates a group that uses this pool to find peers and makes it available
+// to them.
+func (p *HTTPPool) NewGroup(name string, cacheSize, hotSize uint64, loader Loader) (*Group, error) {
+	group, err := NewGroup(name, cacheSize, hotSize, p, loader)
+	if err != nil {
+		return nil, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.groups[name] = group
+	return group, nil
+}
+
+func (p *HTTPPool) PickPeer(key string) (Peer, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	owner := p.ring.Get(key)
+	if owner == "" || owner == p.self {
+		return nil, false
+	}
+
+	return p.peers[owner], true
+}
+
+/**
+Serves requests from other peers:
+
+	GET <base>/<group>/<key>              the value, keys in X-Multicache-Keys
+	PUT <base>/<group>/?key=k1&key=k2     store the body under the given keys
+
+GET always answers from the local main cache so requests never bounce between
+peers that disagree about the ring. A PUT body larger than the pool's
+MaxValueSize is rejected with 413 Request Entity Too Large.
+**/
+func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, DefaultBasePath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.SplitN(r.URL.Path[len(DefaultBasePath):], "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	p.lock.RLock()
+	group, ok := p.groups[parts[0]]
+	p.lock.RUnlock()
+
+	if !ok {
+		http.Error(w, "no such group: "+parts[0], http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		value, keys, err := group.getLocally(r.Context(), parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set(keysHeader, url.Values{"key": keys}.Encode())
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(value)
+	case "PUT":
+		value, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, p.maxValueSize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, ValueTooLargeError.Error(), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		keys := r.URL.Query()["key"]
+		if len(keys) == 0 {
+			http.Error(w, "no keys given", http.StatusBadRequest)
+			return
+		}
+
+		group.putLocally(value, keys)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// A peer reached over HTTP.
+type httpPeer struct {
+	baseURL      string
+	client       *http.Client
+	maxValueSize int64
+}
+
+func (h *httpPeer) Get(ctx context.Context, group, key string) ([]byte, []string, error) {
+	u := h.baseURL + url.PathEscape(group) + "/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("peer %s returned %s", h.baseURL, resp.Status)
+	}
+
+	// Read one byte past the limit to tell a full value from a cut off one.
+	value, err := ioutil.ReadAll(io.LimitReader(resp.Body, h.maxValueSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if int64(len(value)) > h.maxValueSize {
+		return nil, nil, ValueTooLargeError
+	}
+
+	keys, err := url.ParseQuery(resp.Header.Get(keysHeader))
+	if err != nil || len(keys["key"]) == 0 {
+		// Fall back to the key we asked for.
+		return value, []string{key}, nil
+	}
+
+	return value, keys["key"], nil
+}
+
+func (h *httpPeer) Put(ctx context.Context, group string, value []byte, keys []string) error {
+	u := h.baseURL + url.PathEscape(group) + "/?" + url.Values{"key": keys}.Encode()
+	req, err := http.NewRequestWithContext(ctx, "PUT", u, bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("peer %s returned %s", h.baseURL, resp.Status)
+	}
+
+	return nil
+}
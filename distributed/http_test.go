@@ -0,0 +1,221 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// A set of peers on localhost sharing the "test" group.
+type testCluster struct {
+	servers []*httptest.Server
+	pools   []*HTTPPool
+	groups  []*Group
+
+	lock sync.Mutex
+	// The peer URL each load happened on, by key
+	loads map[string][]string
+}
+
+// Items are "value-of-<key>" and keys starting with "multi" come with the
+// aliases multi-a, multi-b and multi-c.
+func newTestCluster(t *testing.T, size int) *testCluster {
+	cluster := &testCluster{loads: make(map[string][]string)}
+
+	urls := []string{}
+	for i := 0; i < size; i++ {
+		index := i
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cluster.pools[index].ServeHTTP(w, r)
+		}))
+
+		cluster.servers = append(cluster.servers, server)
+		urls = append(urls, server.URL)
+	}
+
+	for _, url := range urls {
+		self := url
+		pool := NewHTTPPool(self)
+		pool.Set(urls...)
+
+		group, err := pool.NewGroup("test", 100, 10, func(key string) ([]byte, []string, error) {
+			cluster.lock.Lock()
+			cluster.loads[key] = append(cluster.loads[key], self)
+			cluster.lock.Unlock()
+
+			if key == "error" {
+				return nil, nil, errors.New("load failed")
+			}
+
+			if strings.HasPrefix(key, "multi") {
+				return []byte("value-of-multi"), []string{"multi-a", "multi-b", "multi-c"}, nil
+			}
+
+			return []byte("value-of-" + key), []string{key}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cluster.pools = append(cluster.pools, pool)
+		cluster.groups = append(cluster.groups, group)
+	}
+
+	return cluster
+}
+
+func (c *testCluster) Close() {
+	for _, server := range c.servers {
+		server.Close()
+	}
+}
+
+func (c *testCluster) owner(key string) string {
+	return c.pools[0].ring.Get(key)
+}
+
+func TestGroupLoadsOnlyOnOwner(t *testing.T) {
+	cluster := newTestCluster(t, 3)
+	defer cluster.Close()
+
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, key := range keys {
+		for _, group := range cluster.groups {
+			value, err := group.Get(key)
+			assert(t, err == nil, "Get failed")
+			assert(t, string(value) == "value-of-"+key, "Wrong value for "+key)
+		}
+	}
+
+	for _, key := range keys {
+		loads := cluster.loads[key]
+		assert(t, len(loads) == 1, "Key loaded more than once: "+key)
+		assert(t, len(loads) > 0 && loads[0] == cluster.owner(key), "Key loaded off its owner: "+key)
+	}
+}
+
+func TestGroupMultiKey(t *testing.T) {
+	cluster := newTestCluster(t, 3)
+	defer cluster.Close()
+
+	value, err := cluster.groups[0].Get("multi-a")
+	assert(t, err == nil && string(value) == "value-of-multi", "Couldn't load multikey item")
+
+	// Every alias resolves from every peer without loading again
+	for _, key := range []string{"multi-a", "multi-b", "multi-c"} {
+		for _, group := range cluster.groups {
+			value, err := group.Get(key)
+			assert(t, err == nil, "Get failed")
+			assert(t, string(value) == "value-of-multi", "Wrong value for alias "+key)
+		}
+	}
+
+	total := 0
+	for _, loads := range cluster.loads {
+		total += len(loads)
+	}
+	assert(t, total == 1, "Multikey item loaded more than once")
+}
+
+func TestGroupErrors(t *testing.T) {
+	cluster := newTestCluster(t, 2)
+	defer cluster.Close()
+
+	for _, group := range cluster.groups {
+		_, err := group.Get("error")
+		assert(t, err != nil, "Loader error swallowed")
+	}
+
+	_, err := NewGroup("nil", 10, 10, nil, nil)
+	assert(t, err == NoLoaderError, "Group created without loader")
+}
+
+func TestGroupWithoutPeers(t *testing.T) {
+	loads := 0
+	group, _ := NewGroup("solo", 10, 10, nil, func(key string) ([]byte, []string, error) {
+		loads++
+		return []byte(key), []string{key}, nil
+	})
+
+	group.Get("foo")
+	value, _ := group.Get("foo")
+	assert(t, string(value) == "foo", "Wrong value")
+	assert(t, loads == 1, "Value not cached")
+
+	group.Remove("foo")
+	group.Get("foo")
+	assert(t, loads == 2, "Removed value still cached")
+}
+
+func TestHTTPPoolBadRequests(t *testing.T) {
+	pool := NewHTTPPool("http://localhost")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	for _, path := range []string{"/elsewhere", DefaultBasePath + "nogroup", DefaultBasePath + "missing/key"} {
+		resp, err := http.Get(server.URL + path)
+		assert(t, err == nil && resp.StatusCode >= 400, "Bad request served: "+path)
+	}
+}
+
+func TestHTTPPoolValueTooLarge(t *testing.T) {
+	pool := NewHTTPPoolOptions("http://localhost", &HTTPPoolOptions{MaxValueSize: 4})
+	pool.NewGroup("test", 10, 10, func(key string) ([]byte, []string, error) {
+		return []byte("12345"), []string{key}, nil
+	})
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	req, _ := http.NewRequest("PUT", server.URL+DefaultBasePath+"test/?key=a", bytes.NewReader([]byte("12345")))
+	resp, err := http.DefaultClient.Do(req)
+	assert(t, err == nil && resp.StatusCode == http.StatusRequestEntityTooLarge, "Oversized PUT accepted")
+
+	peer := &httpPeer{baseURL: server.URL + DefaultBasePath, client: http.DefaultClient, maxValueSize: 4}
+	_, _, err = peer.Get(context.Background(), "test", "a")
+	assert(t, err == ValueTooLargeError, fmt.Sprint("Oversized value fetched, err: ", err))
+}
+
+func TestHTTPPoolStalledPeer(t *testing.T) {
+	release := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer stalled.Close()
+	defer close(release)
+
+	pool := NewHTTPPoolOptions("http://localhost", &HTTPPoolOptions{Client: &http.Client{Timeout: 50 * time.Millisecond}})
+	pool.Set("http://localhost", stalled.URL)
+	group, _ := pool.NewGroup("test", 10, 10, func(key string) ([]byte, []string, error) {
+		return []byte(key), []string{key}, nil
+	})
+
+	key := "a"
+	for i := 0; pool.ring.Get(key) != stalled.URL; i++ {
+		key = fmt.Sprint("key-", i)
+	}
+
+	start := time.Now()
+	_, err := group.Get(key)
+	assert(t, err != nil, "Stalled peer returned a value")
+	assert(t, time.Since(start) < time.Second, "Client timeout ignored")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = group.GetContext(ctx, key)
+	assert(t, errors.Is(err, context.Canceled), fmt.Sprint("Canceled context ignored, err: ", err))
+}
@@ -0,0 +1,91 @@
+package distributed
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// Maps bytes to a point on the ring.
+type HashFunc func(data []byte) uint32
+
+/**
+Ring is a consistent hash ring. Each peer is placed on the ring several times
+(its replicas) and a key belongs to the first peer clockwise from the key's
+hash, so adding or removing a peer only moves the keys next to it.
+
+Ring is not safe for concurrent modification; build it fully before sharing.
+**/
+type Ring struct {
+	hash     HashFunc
+	replicas int
+	points   []uint32
+	owners   map[uint32]string
+}
+
+// Creates an empty ring placing each peer replicas times. If hash is nil
+// crc32.ChecksumIEEE is used.
+func NewRing(replicas int, hash HashFunc) *Ring {
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
+
+	if replicas <= 0 {
+		replicas = 1
+	}
+
+	return &Ring{
+		hash:     hash,
+		replicas: replicas,
+		owners:   make(map[uint32]string),
+	}
+}
+
+// Places the given peers on the ring.
+func (r *Ring) Add(peers ...string) {
+	for _, peer := range peers {
+		for i := 0; i < r.replicas; i++ {
+			point := r.hash([]byte(strconv.Itoa(i) + peer))
+			r.points = append(r.points, point)
+			r.owners[point] = peer
+		}
+	}
+
+	sort.Sort(uint32Slice(r.points))
+}
+
+// True if there are no peers on the ring.
+func (r *Ring) IsEmpty() bool {
+	return len(r.points) == 0
+}
+
+// Returns the peer that owns key, or "" if the ring is empty.
+func (r *Ring) Get(key string) string {
+	if r.IsEmpty() {
+		return ""
+	}
+
+	point := r.hash([]byte(key))
+	index := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+
+	// Wrap around to the start of the ring
+	if index == len(r.points) {
+		index = 0
+	}
+
+	return r.owners[r.points[index]]
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
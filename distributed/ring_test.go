@@ -0,0 +1,85 @@
+package distributed
+
+import (
+	"strconv"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func assert(t *testing.T, assertion bool, errinfo string) {
+	if !assertion {
+		t.Error(errinfo)
+	}
+}
+
+// Hashes numeric strings to their value so ring positions are predictable.
+func numericHash(data []byte) uint32 {
+	n, _ := strconv.Atoi(string(data))
+	return uint32(n)
+}
+
+type RingTestcase struct {
+	key      string
+	expected string
+}
+
+func TestRingGet(t *testing.T) {
+	// With replicas 0 and 1, peer "2" sits at 2 and 12, "4" at 4 and 14
+	// and "6" at 6 and 16.
+	ring := NewRing(2, numericHash)
+	ring.Add("6", "4", "2")
+
+	testcases := []RingTestcase{
+		{"2", "2"},
+		{"3", "4"},
+		{"11", "2"},
+		{"13", "4"},
+		{"15", "6"},
+		// Past the last point we wrap around
+		{"27", "2"},
+	}
+
+	for index, test := range testcases {
+		result := ring.Get(test.key)
+		if result != test.expected {
+			t.Error("Unexpected result, index:", index, "result:", result, "testcase:", test)
+		}
+	}
+
+	// Adding 8 (at 8 and 18) only takes over keys between 16 and 18
+	ring.Add("8")
+	assert(t, ring.Get("17") == "8", "New peer didn't take its keys")
+	assert(t, ring.Get("27") == "2", "Unrelated key moved")
+	assert(t, ring.Get("13") == "4", "Unrelated key moved")
+}
+
+func TestRingEmpty(t *testing.T) {
+	ring := NewRing(3, nil)
+	assert(t, ring.IsEmpty(), "New ring not empty")
+	assert(t, ring.Get("foo") == "", "Empty ring returned an owner")
+
+	ring.Add("a", "b")
+	assert(t, !ring.IsEmpty(), "Ring empty after adding peers")
+	assert(t, ring.Get("foo") == ring.Get("foo"), "Ring not deterministic")
+}
+
+func TestRingBalance(t *testing.T) {
+	ring := NewRing(DefaultReplicas, nil)
+	ring.Add("http://a", "http://b", "http://c")
+
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		counts[ring.Get(strconv.Itoa(i))]++
+	}
+
+	for peer, count := range counts {
+		assert(t, count > 500, "Peer got too few keys: "+peer)
+	}
+}
@@ -36,4 +36,7 @@ func main() {
 	// We even have time expiring caches, items expire after the given number
 	// of ms. (10 items, 1000ms)
 	multicache.CreateTimeExpireMulticache(10, 1000)
+
+	// Algorithms can also be picked by name, handy for configuration files
+	multicache.NewMulticacheFromSpec(10, "timed:expire=1s")
 }
@@ -13,11 +13,9 @@ and the optimal caching algorithm.
 
 import (
 	"fmt"
-	"math/rand"
-	"sort"
-	"strconv"
 
 	"github.com/josephlewis42/multicache"
+	"github.com/josephlewis42/multicache/workload"
 )
 
 const (
@@ -32,34 +30,17 @@ func main() {
 
 	// Build tests from 0 chance of repeat to 100
 	for repeatChance := 0.0; repeatChance <= 1; repeatChance += .1 {
-		data := []string{}
-
-		for i := 0; i < TestSize; i++ {
-			if i > CacheSize && rand.Float64() < repeatChance {
-				// Give a chance to recently used values, likely to happen in the
-				// real world
-				index := (rand.Int() % (CacheSize - 1)) + 1
-				chosen := data[i-index]
-				data = append(data, chosen)
-
-			} else {
-				// rnadomly change to 1 of 15 items
-				randval := rand.Int() % UniqueElements
-				data = append(data, strconv.Itoa(randval))
-			}
-		}
+		// Give a chance to recently used values, likely to happen in the real
+		// world
+		generator := workload.NewRepeatChance(int64(len(tests)), UniqueElements, CacheSize-1, repeatChance)
+		data := workload.Keys(generator, TestSize)
 
 		testName := fmt.Sprintf("%3.0f%% Chance of Repeat", repeatChance*100)
 		tests[testName] = &data
 	}
 
 	// Set up the algorithms we're going to test
-	algs := map[string]multicache.ReplacementAlgorithm{"Round Robin": &multicache.RoundRobin{},
-		"LRU":           &multicache.LeastRecentlyUsed{},
-		"Random":        &multicache.Random{},
-		"Second Chance": &multicache.SecondChance{}}
-
-	algnames := getSortedKeys(algs)
+	algs, _ := multicache.ParseAlgorithmList("lru,random,round-robin,second-chance")
 
 	for testname, data := range tests {
 		fmt.Println(testname)
@@ -68,28 +49,16 @@ func main() {
 		fmt.Printf("Optimal Hit Percentage: %f\n\n", optimal)
 		fmt.Printf("%-15s %-10s %-12s\n", "Algorithm", "Hit %", "% of optimal")
 
-		for _, algname := range algnames {
-			alg := algs[algname]
-
-			amt := multicache.CalculateHitMiss(*data, CacheSize, alg)
+		for _, alg := range algs {
+			amt := multicache.CalculateHitMiss(*data, CacheSize, alg.New())
 
 			// Change everything to percentages
 			amt *= 100
 			pctOfOptimal := amt / optimal
 
-			fmt.Printf("%-15s %3.5f   %3.5f\n", algname, amt, pctOfOptimal)
+			fmt.Printf("%-15s %3.5f   %3.5f\n", alg.Name, amt, pctOfOptimal)
 		}
 		fmt.Println()
 	}
 
 }
-
-func getSortedKeys(m map[string]multicache.ReplacementAlgorithm) []string {
-	var keys []string
-	for k := range m {
-		keys = append(keys, k)
-	}
-
-	sort.Strings(keys)
-	return keys
-}
@@ -6,17 +6,18 @@ keys and replacement algorithms.
 
 Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
 Licensed under the MIT license
+
+This compares against golang-lru, see cmd/speedtest for a version that takes
+flags and can compare against an earlier run.
 **/
 
 import (
 	"fmt"
-	"math/rand"
 	"runtime"
-	"sort"
-	"strconv"
 	"testing"
 
 	"github.com/josephlewis42/multicache"
+	"github.com/josephlewis42/multicache/workload"
 
 	"github.com/dkumor/golang-lru"
 )
@@ -43,43 +44,22 @@ const (
 )
 
 func main() {
-	// The main test data
-	data := []string{}
-
-	for i := 0; i < TestSize; i++ {
-		if i > CacheSize && rand.Float64() < RepeatChance {
-			// Give a chance to recently used values, likely to happen in the
-			// real world
-			index := (rand.Int() % (CacheSize - 1)) + 1
-			chosen := data[i-index]
-			data = append(data, chosen)
-
-		} else {
-			// rnadomly change to 1 of 15 items
-			randval := rand.Int() % UniqueElements
-			data = append(data, strconv.Itoa(randval))
-		}
-	}
+	// The main test data, recently used values are given a chance to repeat
+	// like they would in the real world
+	generator := workload.NewRepeatChance(1, UniqueElements, CacheSize-1, RepeatChance)
+	data := workload.Keys(generator, TestSize)
 
 	// Set up the algorithms we're going to test
-	algs := map[string]multicache.ReplacementAlgorithm{"Round Robin": &multicache.RoundRobin{},
-		"LRU":           &multicache.LeastRecentlyUsed{},
-		"Random":        &multicache.Random{},
-		"Second Chance": &multicache.SecondChance{},
-		"Timed Cache":   multicache.CreateTimeExpireAlgorithm(1000)}
-
-	algnames := getSortedKeys(algs)
+	algs, _ := multicache.ParseAlgorithmList("lru,random,round-robin,second-chance,timed:expire=1s")
 
 	for thread := 1; thread <= MaxThreads; thread++ {
 		fmt.Printf("%d Threads\n", thread)
 		runtime.GOMAXPROCS(thread)
-		for _, algname := range algnames {
-			alg := algs[algname]
-
-			wrapped := wrapForParallelBenchmarking(data, alg, CacheSize, thread)
+		for _, alg := range algs {
+			wrapped := wrapForParallelBenchmarking(data, alg.New(), CacheSize, thread)
 
 			result := testing.Benchmark(wrapped)
-			showResults(algname, result)
+			showResults(alg.Name, result)
 		}
 
 		// Test golang-lru
@@ -161,13 +141,3 @@ func golangLruParallelBenchmarking(data []string, CacheSize uint64) func(b *test
 		})
 	}
 }
-
-func getSortedKeys(m map[string]multicache.ReplacementAlgorithm) []string {
-	var keys []string
-	for k := range m {
-		keys = append(keys, k)
-	}
-
-	sort.Strings(keys)
-	return keys
-}
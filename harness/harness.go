@@ -0,0 +1,374 @@
+package harness
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/josephlewis42/multicache"
+	"github.com/josephlewis42/multicache/workload"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Package harness measures a Multicache under concurrent load. Goroutines make a
+configurable mix of operations and the latency of every one is recorded, so
+the tail latency caused by goroutines waiting on the cache's lock shows up
+rather than being averaged away like in testing.Benchmark.
+**/
+
+// An operation made on the cache.
+type Op int
+
+const (
+	OpGet Op = iota
+	OpAdd
+	OpAddMany
+	OpRemove
+	OpGetOrFind
+
+	opCount
+)
+
+var opNames = [opCount]string{"get", "add", "addmany", "remove", "getorfind"}
+
+func (op Op) String() string {
+	if op < 0 || op >= opCount {
+		return "op(" + strconv.Itoa(int(op)) + ")"
+	}
+
+	return opNames[op]
+}
+
+// The relative weights of each operation, a Get weight of 9 with an Add
+// weight of 1 makes 90% of operations Gets.
+type Mix struct {
+	Get       int
+	Add       int
+	AddMany   int
+	Remove    int
+	GetOrFind int
+}
+
+// A read heavy mix typical of caches.
+var DefaultMix = Mix{Get: 90, Add: 4, AddMany: 2, Remove: 1, GetOrFind: 3}
+
+func (m Mix) weights() [opCount]int {
+	return [opCount]int{m.Get, m.Add, m.AddMany, m.Remove, m.GetOrFind}
+}
+
+func (m Mix) String() string {
+	parts := []string{}
+	for op, weight := range m.weights() {
+		if weight > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", Op(op), weight))
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// Parses a mix written like "get=90,add=5,remove=5", the format String
+// returns. Operations that aren't mentioned get a weight of 0.
+func ParseMix(s string) (Mix, error) {
+	var weights [opCount]int
+	total := 0
+
+	for _, part := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.Atoi(value)
+		if !ok || err != nil || weight < 0 {
+			return Mix{}, fmt.Errorf("invalid mix entry %q", part)
+		}
+
+		found := false
+		for op, opName := range opNames {
+			if opName == strings.ToLower(name) {
+				weights[op] = weight
+				found = true
+			}
+		}
+
+		if !found {
+			return Mix{}, fmt.Errorf("unknown operation %q", name)
+		}
+
+		total += weight
+	}
+
+	if total == 0 {
+		return Mix{}, fmt.Errorf("mix %q has no operations", s)
+	}
+
+	return Mix{weights[OpGet], weights[OpAdd], weights[OpAddMany], weights[OpRemove], weights[OpGetOrFind]}, nil
+}
+
+// What to run, the zero value of each field is replaced by its default.
+type Config struct {
+	// Defaults to 1000
+	CacheSize uint64
+	// Defaults to 1
+	Goroutines int
+	// Operations made by each goroutine, defaults to 100000
+	Operations int
+	// Defaults to DefaultMix
+	Mix Mix
+	// Creates the keys each goroutine uses, by default a Zipfian
+	// distribution over ten times CacheSize keys.
+	NewGenerator func(seed int64) workload.Generator
+	// Goroutine i seeds its generator with Seed+i
+	Seed int64
+}
+
+func (c Config) withDefaults() Config {
+	if c.CacheSize == 0 {
+		c.CacheSize = 1000
+	}
+
+	if c.Goroutines <= 0 {
+		c.Goroutines = 1
+	}
+
+	if c.Operations <= 0 {
+		c.Operations = 100000
+	}
+
+	if c.Mix == (Mix{}) {
+		c.Mix = DefaultMix
+	}
+
+	if c.NewGenerator == nil {
+		keys := int(c.CacheSize) * 10
+		c.NewGenerator = func(seed int64) workload.Generator {
+			return workload.NewZipfian(seed, keys, 0.99)
+		}
+	}
+
+	return c
+}
+
+// Latency percentiles of a set of operations.
+type Latency struct {
+	Count int
+	P50   time.Duration
+	P99   time.Duration
+	P999  time.Duration
+	Max   time.Duration
+}
+
+// The outcome of running an algorithm.
+type Result struct {
+	Algorithm  string
+	Goroutines int
+	Operations int
+	Elapsed    time.Duration
+	// Operations per second across all goroutines
+	OpsPerSecond float64
+
+	Latency Latency
+	ByOp    map[Op]Latency
+
+	// Time goroutines spent waiting for the cache's lock, see
+	// Multicache.LockStats
+	LockWait       time.Duration
+	ContendedLocks uint64
+}
+
+// Runs config against a cache using algorithm.
+func Run(config Config, algorithm multicache.NamedAlgorithm) Result {
+	return newRun(config, algorithm).execute()
+}
+
+// Runs config against each algorithm in turn.
+func RunAll(config Config, algorithms []multicache.NamedAlgorithm) []Result {
+	results := []Result{}
+	for _, algorithm := range algorithms {
+		results = append(results, Run(config, algorithm))
+	}
+
+	return results
+}
+
+/**
+Prepares config against a cache using algorithm and returns the function that
+runs it, so benchmarks can leave the setup out of their timing. See the
+harnesstest package.
+**/
+func Prepare(config Config, algorithm multicache.NamedAlgorithm) func() Result {
+	return newRun(config, algorithm).execute
+}
+
+// Everything prepared before timing starts.
+type run struct {
+	config    Config
+	algorithm multicache.NamedAlgorithm
+	cache     *multicache.Multicache
+	workers   []*worker
+}
+
+type worker struct {
+	random    *rand.Rand
+	generator workload.Generator
+	// Nanoseconds taken by each operation, by operation
+	latencies [opCount][]int64
+}
+
+func newRun(config Config, algorithm multicache.NamedAlgorithm) *run {
+	config = config.withDefaults()
+
+	cache, _ := multicache.NewMulticache(config.CacheSize, algorithm.New())
+	cache.EnableLockStats()
+
+	weights := config.Mix.weights()
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	r := &run{config: config, algorithm: algorithm, cache: cache}
+	for i := 0; i < config.Goroutines; i++ {
+		w := &worker{
+			random:    rand.New(rand.NewSource(config.Seed + int64(i))),
+			generator: config.NewGenerator(config.Seed + int64(i)),
+		}
+
+		for op := range w.latencies {
+			w.latencies[op] = make([]int64, 0, config.Operations*weights[op]/total+1)
+		}
+
+		r.workers = append(r.workers, w)
+	}
+
+	return r
+}
+
+func (r *run) execute() Result {
+	weights := r.config.Mix.weights()
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	var wait sync.WaitGroup
+	start := time.Now()
+
+	for _, w := range r.workers {
+		wait.Add(1)
+		go func(w *worker) {
+			defer wait.Done()
+
+			for i := 0; i < r.config.Operations; i++ {
+				op := pickOp(weights, w.random.Intn(total))
+				request := w.generator.Next()
+
+				opStart := time.Now()
+				r.perform(op, request)
+				w.latencies[op] = append(w.latencies[op], int64(time.Since(opStart)))
+			}
+		}(w)
+	}
+
+	wait.Wait()
+	elapsed := time.Since(start)
+
+	result := Result{
+		Algorithm:  r.algorithm.Name,
+		Goroutines: r.config.Goroutines,
+		Operations: r.config.Operations * r.config.Goroutines,
+		Elapsed:    elapsed,
+		ByOp:       make(map[Op]Latency),
+	}
+
+	if elapsed > 0 {
+		result.OpsPerSecond = float64(result.Operations) / elapsed.Seconds()
+	}
+
+	all := []int64{}
+	for op := Op(0); op < opCount; op++ {
+		latencies := []int64{}
+		for _, w := range r.workers {
+			latencies = append(latencies, w.latencies[op]...)
+		}
+
+		if len(latencies) > 0 {
+			result.ByOp[op] = percentiles(latencies)
+			all = append(all, latencies...)
+		}
+	}
+
+	result.Latency = percentiles(all)
+
+	lockStats := r.cache.LockStats()
+	result.LockWait = lockStats.Wait
+	result.ContendedLocks = lockStats.Contended
+	return result
+}
+
+func (r *run) perform(op Op, request workload.Request) {
+	switch op {
+	case OpGet:
+		r.cache.Get(request.Key)
+	case OpAdd:
+		r.cache.Add(request.Key, request.Key)
+	case OpAddMany:
+		keys := request.Aliases
+		if len(keys) == 0 {
+			keys = []string{request.Key, request.Key + "/alias"}
+		}
+		r.cache.AddMany(request.Key, keys...)
+	case OpRemove:
+		r.cache.Remove(request.Key)
+	case OpGetOrFind:
+		r.cache.GetOrFind(request.Key, func(key string) (interface{}, []string, error) {
+			return key, []string{key}, nil
+		})
+	}
+}
+
+// Picks the operation that choice, between 0 and the total weight, lands on.
+func pickOp(weights [opCount]int, choice int) Op {
+	for op, weight := range weights {
+		if choice < weight {
+			return Op(op)
+		}
+		choice -= weight
+	}
+
+	return opCount - 1
+}
+
+// Sorts latencies in place.
+func percentiles(latencies []int64) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	at := func(percentile float64) time.Duration {
+		// Nearest rank
+		index := int(math.Ceil(percentile*float64(len(latencies)))) - 1
+		if index < 0 {
+			index = 0
+		}
+
+		return time.Duration(latencies[index])
+	}
+
+	return Latency{
+		Count: len(latencies),
+		P50:   at(0.50),
+		P99:   at(0.99),
+		P999:  at(0.999),
+		Max:   time.Duration(latencies[len(latencies)-1]),
+	}
+}
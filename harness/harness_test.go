@@ -0,0 +1,81 @@
+package harness
+
+import (
+	"testing"
+	"time"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func assert(t *testing.T, assertion bool, errinfo string) {
+	if !assertion {
+		t.Error(errinfo)
+	}
+}
+
+var lru = multicache.NamedAlgorithm{Name: "lru", New: func() multicache.ReplacementAlgorithm {
+	return &multicache.LeastRecentlyUsed{}
+}}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("get=8, Add=1,remove=1")
+	assert(t, err == nil && mix == Mix{Get: 8, Add: 1, Remove: 1}, "Mix not parsed")
+	assert(t, mix.String() == "get=8,add=1,remove=1", "Unexpected string "+mix.String())
+
+	parsed, err := ParseMix(DefaultMix.String())
+	assert(t, err == nil && parsed == DefaultMix, "Mix didn't round trip")
+
+	for _, invalid := range []string{"", "get", "get=-1", "fetch=1", "get=0"} {
+		_, err := ParseMix(invalid)
+		assert(t, err != nil, "Invalid mix accepted: "+invalid)
+	}
+}
+
+func TestPickOp(t *testing.T) {
+	weights := Mix{Get: 2, Remove: 1}.weights()
+	assert(t, pickOp(weights, 0) == OpGet && pickOp(weights, 1) == OpGet, "Get not picked")
+	assert(t, pickOp(weights, 2) == OpRemove, "Remove not picked")
+}
+
+func TestPercentiles(t *testing.T) {
+	latencies := make([]int64, 1000)
+	for i := range latencies {
+		latencies[i] = int64(1000 - i)
+	}
+
+	latency := percentiles(latencies)
+	assert(t, latency.Count == 1000 && latency.P50 == 500 && latency.P99 == 990, "Wrong percentiles")
+	assert(t, latency.P999 == 999 && latency.Max == 1000, "Wrong tail percentiles")
+	assert(t, percentiles(nil) == Latency{}, "Empty latencies")
+}
+
+func TestRun(t *testing.T) {
+	result := Run(Config{
+		CacheSize:  100,
+		Goroutines: 4,
+		Operations: 5000,
+		Mix:        Mix{Get: 8, AddMany: 1, GetOrFind: 1},
+	}, lru)
+
+	assert(t, result.Algorithm == "lru" && result.Operations == 20000, "Wrong operation count")
+	assert(t, result.OpsPerSecond > 0 && result.Elapsed > 0, "Throughput not measured")
+
+	count := 0
+	for op, latency := range result.ByOp {
+		assert(t, op == OpGet || op == OpAddMany || op == OpGetOrFind, "Operation outside the mix: "+op.String())
+		count += latency.Count
+	}
+	assert(t, count == result.Operations, "Latencies missing")
+
+	latency := result.Latency
+	assert(t, latency.P50 <= latency.P99 && latency.P99 <= latency.P999 && latency.P999 <= latency.Max, "Percentiles out of order")
+	assert(t, latency.Max < time.Minute, "Unreasonable latency")
+}
@@ -0,0 +1,43 @@
+package harnesstest
+
+import (
+	"testing"
+
+	"github.com/josephlewis42/multicache"
+	"github.com/josephlewis42/multicache/harness"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Package harnesstest runs the harness from go test benchmarks. It's kept apart
+from the harness package so programs using the harness don't import testing.
+**/
+
+/**
+Runs b.N operations spread over config.Goroutines for use in go test
+benchmarks, reporting the percentiles and lock wait as extra metrics.
+config.Operations is ignored.
+**/
+func Benchmark(b *testing.B, config harness.Config, algorithm multicache.NamedAlgorithm) harness.Result {
+	goroutines := config.Goroutines
+	if goroutines <= 0 {
+		goroutines = 1
+	}
+	config.Operations = (b.N + goroutines - 1) / goroutines
+
+	run := harness.Prepare(config, algorithm)
+	b.ResetTimer()
+	result := run()
+	b.StopTimer()
+
+	b.ReportMetric(float64(result.Latency.P50.Nanoseconds()), "p50-ns")
+	b.ReportMetric(float64(result.Latency.P99.Nanoseconds()), "p99-ns")
+	b.ReportMetric(float64(result.Latency.P999.Nanoseconds()), "p999-ns")
+	b.ReportMetric(float64(result.LockWait.Nanoseconds())/float64(result.Operations), "lockwait-ns/op")
+	return result
+}
@@ -0,0 +1,26 @@
+package harnesstest
+
+import (
+	"testing"
+
+	"github.com/josephlewis42/multicache"
+	"github.com/josephlewis42/multicache/harness"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func BenchmarkLRU(b *testing.B) {
+	lru, _ := multicache.ParseAlgorithm("lru")
+	Benchmark(b, harness.Config{Goroutines: 4}, lru)
+}
+
+func BenchmarkSecondChance(b *testing.B) {
+	secondChance, _ := multicache.ParseAlgorithm("second-chance")
+	Benchmark(b, harness.Config{Goroutines: 4}, secondChance)
+}
@@ -0,0 +1,110 @@
+package invalidation
+
+import "sync"
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// Message tells replicas to drop items.
+type Message struct {
+	// The replica the removal happened on
+	Origin string `json:"origin"`
+	// True if the whole cache was purged, Keys is empty
+	Purge bool `json:"purge,omitempty"`
+	// Every key of the removed item
+	Keys []string `json:"keys,omitempty"`
+}
+
+// Handler receives the messages published on a bus.
+type Handler func(msg Message)
+
+/**
+Bus carries invalidation messages between replicas. Messages may be delivered
+to the publisher's own subscribers too; replicas ignore their own messages.
+**/
+type Bus interface {
+	// Sends msg to every subscriber.
+	Publish(msg Message) error
+	// Calls handler for each message until the returned cancel function is
+	// called.
+	Subscribe(handler Handler) (cancel func())
+	// Stops delivering messages and releases any network resources.
+	Close() error
+}
+
+/**
+subscribers holds the handlers of a bus, it's shared by the implementations.
+**/
+type subscribers struct {
+	lock     sync.RWMutex
+	nextID   int
+	handlers map[int]Handler
+}
+
+func (s *subscribers) add(handler Handler) func() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.handlers == nil {
+		s.handlers = make(map[int]Handler)
+	}
+
+	id := s.nextID
+	s.nextID++
+	s.handlers[id] = handler
+
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		delete(s.handlers, id)
+	}
+}
+
+func (s *subscribers) deliver(msg Message) {
+	s.lock.RLock()
+	handlers := make([]Handler, 0, len(s.handlers))
+	for _, handler := range s.handlers {
+		handlers = append(handlers, handler)
+	}
+	s.lock.RUnlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+}
+
+/**
+LocalBus delivers messages between replicas in the same process. Publish
+calls every handler before returning.
+**/
+type LocalBus struct {
+	subscribers
+}
+
+// Creates an in-process bus.
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+func (b *LocalBus) Publish(msg Message) error {
+	b.deliver(msg)
+	return nil
+}
+
+func (b *LocalBus) Subscribe(handler Handler) func() {
+	return b.add(handler)
+}
+
+func (b *LocalBus) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.handlers = nil
+	return nil
+}
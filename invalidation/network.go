@@ -0,0 +1,282 @@
+package invalidation
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+const (
+	// Largest message the multicast bus will send or receive
+	maxDatagramSize = 64 * 1024
+
+	// How long the TCP bus waits on a peer before giving up on it
+	tcpDialTimeout  = 5 * time.Second
+	tcpWriteTimeout = 5 * time.Second
+)
+
+/**
+TCPBus sends every message to a fixed list of peers over TCP and delivers the
+messages it receives from them. Each process runs one TCPBus listening on its
+own address and lists the other processes as peers. Connections to peers are
+made when needed and re-established after failures, a peer that can't be
+reached or doesn't read its messages is given up on after a few seconds.
+
+Messages are JSON objects, one per line.
+**/
+type TCPBus struct {
+	subscribers
+	listener net.Listener
+
+	lock   sync.Mutex
+	peers  map[string]net.Conn
+	conns  map[net.Conn]bool
+	closed bool
+}
+
+// Listens for peers on listenAddr and publishes to the given peer addresses.
+func NewTCPBus(listenAddr string, peers []string) (*TCPBus, error) {
+	l, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &TCPBus{
+		listener: l,
+		peers:    make(map[string]net.Conn),
+		conns:    make(map[net.Conn]bool),
+	}
+
+	for _, peer := range peers {
+		b.peers[peer] = nil
+	}
+
+	go b.accept()
+	return b, nil
+}
+
+// Returns the address the bus listens on.
+func (b *TCPBus) Addr() net.Addr {
+	return b.listener.Addr()
+}
+
+// Adds a peer to publish to.
+func (b *TCPBus) AddPeer(addr string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.peers[addr]; !ok {
+		b.peers[addr] = nil
+	}
+}
+
+// Sends msg to every peer, returning the last error encountered. A peer that
+// can't be reached doesn't stop the others from receiving the message.
+func (b *TCPBus) Publish(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	// Talk to the peers without the lock so a slow one doesn't hold up
+	// other Publishes or accepting connections.
+	b.lock.Lock()
+	peers := make(map[string]net.Conn, len(b.peers))
+	for addr, conn := range b.peers {
+		peers[addr] = conn
+	}
+	b.lock.Unlock()
+
+	var lastErr error
+	for addr, conn := range peers {
+		if conn == nil {
+			if conn, err = b.dial(addr); err != nil {
+				lastErr = err
+				continue
+			}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+		if _, err := conn.Write(data); err != nil {
+			b.dropPeer(addr, conn)
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+// Connects to a peer, using the connection of a Publish that connected first.
+func (b *TCPBus) dial(addr string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, tcpDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		conn.Close()
+		return nil, net.ErrClosed
+	}
+
+	if existing := b.peers[addr]; existing != nil {
+		conn.Close()
+		return existing, nil
+	}
+
+	b.peers[addr] = conn
+	return conn, nil
+}
+
+// Closes a failed connection so the next Publish reconnects.
+func (b *TCPBus) dropPeer(addr string, conn net.Conn) {
+	conn.Close()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.peers[addr] == conn {
+		b.peers[addr] = nil
+	}
+}
+
+func (b *TCPBus) Subscribe(handler Handler) func() {
+	return b.add(handler)
+}
+
+func (b *TCPBus) Close() error {
+	err := b.listener.Close()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.closed = true
+	for addr, conn := range b.peers {
+		if conn != nil {
+			conn.Close()
+		}
+		b.peers[addr] = nil
+	}
+
+	for conn := range b.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+func (b *TCPBus) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		b.lock.Lock()
+		b.conns[conn] = true
+		b.lock.Unlock()
+
+		go b.receive(conn)
+	}
+}
+
+func (b *TCPBus) receive(conn net.Conn) {
+	defer func() {
+		b.lock.Lock()
+		delete(b.conns, conn)
+		b.lock.Unlock()
+		conn.Close()
+	}()
+
+	decoder := json.NewDecoder(conn)
+	for {
+		var msg Message
+		if err := decoder.Decode(&msg); err != nil {
+			return
+		}
+
+		b.deliver(msg)
+	}
+}
+
+/**
+MulticastBus sends each message as a single UDP datagram to a multicast group,
+every process joined to the group receives it. Delivery is unreliable, as is
+anything over UDP, and messages are limited to 64KB.
+**/
+type MulticastBus struct {
+	subscribers
+	listener *net.UDPConn
+	sender   *net.UDPConn
+}
+
+// Joins the multicast group at groupAddr, e.g. "239.0.0.42:9999". If iface
+// is nil the system chooses the interface.
+func NewMulticastBus(groupAddr string, iface *net.Interface) (*MulticastBus, error) {
+	addr, err := net.ResolveUDPAddr("udp", groupAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.ListenMulticastUDP("udp", iface, addr)
+	if err != nil {
+		return nil, err
+	}
+	listener.SetReadBuffer(maxDatagramSize)
+
+	sender, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	b := &MulticastBus{listener: listener, sender: sender}
+	go b.receive()
+	return b, nil
+}
+
+func (b *MulticastBus) Publish(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.sender.Write(data)
+	return err
+}
+
+func (b *MulticastBus) Subscribe(handler Handler) func() {
+	return b.add(handler)
+}
+
+func (b *MulticastBus) Close() error {
+	b.sender.Close()
+	return b.listener.Close()
+}
+
+func (b *MulticastBus) receive() {
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := b.listener.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		var msg Message
+		if json.Unmarshal(buffer[:n], &msg) == nil {
+			b.deliver(msg)
+		}
+	}
+}
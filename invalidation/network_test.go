@@ -0,0 +1,165 @@
+package invalidation
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// Collects messages delivered by a bus.
+func collect(bus Bus) chan Message {
+	messages := make(chan Message, 10)
+	bus.Subscribe(func(msg Message) {
+		messages <- msg
+	})
+
+	return messages
+}
+
+func receive(messages chan Message) (Message, bool) {
+	select {
+	case msg := <-messages:
+		return msg, true
+	case <-time.After(time.Second):
+		return Message{}, false
+	}
+}
+
+func TestLocalBus(t *testing.T) {
+	bus := NewLocalBus()
+	messages := collect(bus)
+	cancel := bus.Subscribe(func(msg Message) {
+		t.Error("Cancelled handler called")
+	})
+	cancel()
+
+	bus.Publish(Message{Origin: "a", Keys: []string{"k"}})
+	msg, ok := receive(messages)
+	assert(t, ok && msg.Keys[0] == "k", "Message not delivered")
+
+	bus.Close()
+	bus.Publish(Message{Origin: "a", Purge: true})
+	_, ok = receive(messages)
+	assert(t, !ok, "Closed bus delivered a message")
+}
+
+func TestTCPBus(t *testing.T) {
+	a, err := NewTCPBus("127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	b, err := NewTCPBus("127.0.0.1:0", []string{a.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	a.AddPeer(b.Addr().String())
+
+	fromA, fromB := collect(a), collect(b)
+
+	err = b.Publish(Message{Origin: "b", Keys: []string{"x", "y"}})
+	assert(t, err == nil, "Publish failed")
+	msg, ok := receive(fromA)
+	assert(t, ok && msg.Origin == "b" && len(msg.Keys) == 2, "Message not received over TCP")
+
+	a.Publish(Message{Origin: "a", Purge: true})
+	msg, ok = receive(fromB)
+	assert(t, ok && msg.Purge, "Purge not received over TCP")
+}
+
+func TestTCPBusReplicas(t *testing.T) {
+	a, _ := NewTCPBus("127.0.0.1:0", nil)
+	defer a.Close()
+	b, _ := NewTCPBus("127.0.0.1:0", []string{a.Addr().String()})
+	defer b.Close()
+	a.AddPeer(b.Addr().String())
+
+	mcA, _ := multicache.NewDefaultMulticache(10)
+	mcB, _ := multicache.NewDefaultMulticache(10)
+	replicaA, replicaB := NewReplica(mcA, a), NewReplica(mcB, b)
+	defer replicaA.Close()
+	defer replicaB.Close()
+
+	mcA.AddMany("value", "k1", "k2")
+	mcB.AddMany("value", "k1", "k2")
+
+	mcB.Remove("k2")
+	assert(t, eventually(missing(mcA, "k1")), "Removal not propagated over TCP")
+}
+
+func TestTCPBusUnreachablePeer(t *testing.T) {
+	bus, _ := NewTCPBus("127.0.0.1:0", []string{"127.0.0.1:1"})
+	defer bus.Close()
+
+	err := bus.Publish(Message{Origin: "a", Purge: true})
+	assert(t, err != nil, "Unreachable peer not reported")
+}
+
+func TestTCPBusStalledPeer(t *testing.T) {
+	// A peer that accepts connections but never reads from them
+	stalled, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer stalled.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := stalled.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	bus, _ := NewTCPBus("127.0.0.1:0", []string{stalled.Addr().String()})
+	defer bus.Close()
+	messages := collect(bus)
+
+	// Too big to fit in the socket buffers, so the write blocks
+	published := make(chan error)
+	go func() {
+		published <- bus.Publish(Message{Origin: "a", Keys: []string{strings.Repeat("k", 64<<20)}})
+	}()
+
+	conn := <-accepted
+	time.Sleep(50 * time.Millisecond)
+
+	// The bus still takes connections and delivers messages
+	other, _ := NewTCPBus("127.0.0.1:0", []string{bus.Addr().String()})
+	defer other.Close()
+	other.Publish(Message{Origin: "b", Purge: true})
+	msg, ok := receive(messages)
+	assert(t, ok && msg.Origin == "b", "Stalled peer blocked the bus")
+
+	conn.Close()
+	assert(t, <-published != nil, "Failed write not reported")
+}
+
+func TestMulticastBus(t *testing.T) {
+	bus, err := NewMulticastBus("239.0.0.42:19999", nil)
+	if err != nil {
+		t.Skip("multicast unavailable:", err)
+	}
+	defer bus.Close()
+
+	messages := collect(bus)
+	if err := bus.Publish(Message{Origin: "a", Keys: []string{"k"}}); err != nil {
+		t.Skip("multicast unavailable:", err)
+	}
+
+	msg, ok := receive(messages)
+	if !ok {
+		t.Skip("multicast loopback unavailable")
+	}
+
+	assert(t, msg.Origin == "a" && msg.Keys[0] == "k", "Wrong multicast message")
+}
@@ -0,0 +1,191 @@
+package invalidation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+/**
+Replica connects a Multicache to a Bus. Items removed from the cache with
+Remove or RemoveManyFunc, and calls to Purge, are published so every other
+replica drops the whole item as well; removals published by other replicas are
+applied to the cache. Keys dropped by UnlinkKey or added by AddAlias are
+published the same way, so other replicas drop what they hold under them.
+
+Messages are published from a background goroutine because the cache is
+locked while it reports removals. Evictions made by the ReplacementAlgorithm
+are local decisions and are not published.
+**/
+type Replica struct {
+	id     string
+	cache  *multicache.Multicache
+	bus    Bus
+	cancel func()
+
+	lock sync.Mutex
+	// Removals being applied on behalf of other replicas, these must not be
+	// published again.
+	applyingKeys   map[string]int
+	applyingPurges int
+	// Messages waiting to be published
+	queue  []Message
+	wake   chan struct{}
+	closed bool
+	done   chan struct{}
+}
+
+// Starts propagating removals between cache and the other replicas on bus.
+// The Replica takes over the cache's RemoveListener.
+func NewReplica(cache *multicache.Multicache, bus Bus) *Replica {
+	r := &Replica{
+		id:           newReplicaID(),
+		cache:        cache,
+		bus:          bus,
+		applyingKeys: make(map[string]int),
+		wake:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+
+	cache.SetRemoveListener(r.removed)
+	r.cancel = bus.Subscribe(r.apply)
+	go r.publish()
+
+	return r
+}
+
+// Returns the id this replica publishes its messages under.
+func (r *Replica) ID() string {
+	return r.id
+}
+
+// Stops propagating removals. Messages already queued are still published.
+func (r *Replica) Close() {
+	r.cache.SetRemoveListener(nil)
+	r.cancel()
+
+	r.lock.Lock()
+	r.closed = true
+	r.lock.Unlock()
+	r.signal()
+
+	<-r.done
+}
+
+// The cache's RemoveListener, called with the cache locked.
+func (r *Replica) removed(keys []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if keys == nil {
+		if r.applyingPurges > 0 {
+			r.applyingPurges--
+			return
+		}
+
+		r.enqueue(Message{Origin: r.id, Purge: true})
+		return
+	}
+
+	for _, key := range keys {
+		if r.applyingKeys[key] > 0 {
+			r.applyingKeys[key]--
+			return
+		}
+	}
+
+	r.enqueue(Message{Origin: r.id, Keys: keys})
+}
+
+// Must be called with the lock held.
+func (r *Replica) enqueue(msg Message) {
+	if r.closed {
+		return
+	}
+
+	r.queue = append(r.queue, msg)
+	r.signal()
+}
+
+func (r *Replica) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Publishes queued messages until the replica is closed.
+func (r *Replica) publish() {
+	defer close(r.done)
+
+	for range r.wake {
+		r.lock.Lock()
+		queue := r.queue
+		r.queue = nil
+		closed := r.closed
+		r.lock.Unlock()
+
+		for _, msg := range queue {
+			// Invalidation is best effort, a lost message only means a
+			// replica serves a stale value until it is evicted.
+			r.bus.Publish(msg)
+		}
+
+		if closed {
+			return
+		}
+	}
+}
+
+// Applies a message from the bus.
+func (r *Replica) apply(msg Message) {
+	if msg.Origin == r.id {
+		return
+	}
+
+	// The cache can't be called with r.lock held, removed() takes the locks
+	// in the opposite order.
+	r.lock.Lock()
+	if msg.Purge {
+		r.applyingPurges++
+	}
+	for _, key := range msg.Keys {
+		r.applyingKeys[key]++
+	}
+	r.lock.Unlock()
+
+	if msg.Purge {
+		r.cache.Purge()
+	}
+	for _, key := range msg.Keys {
+		r.cache.Remove(key)
+	}
+
+	// Forget anything that wasn't in the local cache.
+	r.lock.Lock()
+	for _, key := range msg.Keys {
+		if r.applyingKeys[key] > 0 {
+			r.applyingKeys[key]--
+		}
+		if r.applyingKeys[key] == 0 {
+			delete(r.applyingKeys, key)
+		}
+	}
+	r.lock.Unlock()
+}
+
+func newReplicaID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
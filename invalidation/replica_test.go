@@ -0,0 +1,172 @@
+package invalidation
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func assert(t *testing.T, assertion bool, errinfo string) {
+	if !assertion {
+		t.Error(errinfo)
+	}
+}
+
+// Waits up to a second for condition to become true.
+func eventually(condition func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return condition()
+}
+
+// Counts the messages published on a bus.
+type countingBus struct {
+	Bus
+	lock  sync.Mutex
+	count int
+}
+
+func (c *countingBus) Publish(msg Message) error {
+	c.lock.Lock()
+	c.count++
+	c.lock.Unlock()
+	return c.Bus.Publish(msg)
+}
+
+func (c *countingBus) published() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.count
+}
+
+func newReplicas(bus Bus, count int) ([]*multicache.Multicache, []*Replica) {
+	caches := []*multicache.Multicache{}
+	replicas := []*Replica{}
+
+	for i := 0; i < count; i++ {
+		mc, _ := multicache.NewDefaultMulticache(10)
+		caches = append(caches, mc)
+		replicas = append(replicas, NewReplica(mc, bus))
+	}
+
+	return caches, replicas
+}
+
+func missing(mc *multicache.Multicache, key string) func() bool {
+	return func() bool {
+		_, ok := mc.Get(key)
+		return !ok
+	}
+}
+
+func TestReplicaRemove(t *testing.T) {
+	bus := &countingBus{Bus: NewLocalBus()}
+	caches, replicas := newReplicas(bus, 3)
+
+	for _, mc := range caches {
+		mc.AddMany("value", "a", "b")
+		mc.Add("c", "other")
+	}
+
+	caches[0].Remove("a")
+
+	for _, mc := range caches[1:] {
+		assert(t, eventually(missing(mc, "b")), "Alias survived on a replica")
+		_, ok := mc.Get("c")
+		assert(t, ok, "Unrelated item removed")
+	}
+
+	for _, replica := range replicas {
+		replica.Close()
+	}
+
+	// Replicas applying the removal mustn't publish it again.
+	assert(t, bus.published() == 1, "Removal was republished")
+}
+
+func TestReplicaUnlinkKey(t *testing.T) {
+	bus := &countingBus{Bus: NewLocalBus()}
+	caches, replicas := newReplicas(bus, 2)
+
+	for _, mc := range caches {
+		mc.AddMany("value", "a", "b")
+	}
+
+	caches[0].UnlinkKey("b")
+	assert(t, eventually(missing(caches[1], "b")), "Unlinked key still served by a replica")
+
+	for _, replica := range replicas {
+		replica.Close()
+	}
+
+	assert(t, bus.published() == 1, "Unlinking was republished")
+}
+
+func TestReplicaRemoveManyFunc(t *testing.T) {
+	caches, replicas := newReplicas(NewLocalBus(), 2)
+	defer replicas[0].Close()
+	defer replicas[1].Close()
+
+	for _, mc := range caches {
+		mc.AddMany("drop", "a", "b")
+		mc.Add("c", "keep")
+	}
+
+	caches[0].RemoveManyFunc(func(item interface{}) bool {
+		return item == "drop"
+	})
+
+	assert(t, eventually(missing(caches[1], "a")), "RemoveManyFunc not propagated")
+	_, ok := caches[1].Get("c")
+	assert(t, ok, "Unrelated item removed")
+}
+
+func TestReplicaPurge(t *testing.T) {
+	bus := &countingBus{Bus: NewLocalBus()}
+	caches, replicas := newReplicas(bus, 2)
+
+	caches[1].Add("a", "value")
+	caches[0].Purge()
+
+	assert(t, eventually(missing(caches[1], "a")), "Purge not propagated")
+
+	replicas[0].Close()
+	replicas[1].Close()
+	assert(t, bus.published() == 1, "Purge was republished")
+
+	// Closed replicas stop propagating
+	caches[1].Add("a", "value")
+	caches[0].Purge()
+	time.Sleep(10 * time.Millisecond)
+	_, ok := caches[1].Get("a")
+	assert(t, ok, "Closed replica still applied messages")
+}
+
+func TestReplicaIgnoresEvictions(t *testing.T) {
+	bus := &countingBus{Bus: NewLocalBus()}
+	caches, replicas := newReplicas(bus, 2)
+
+	for i := 0; i < 50; i++ {
+		caches[0].Add(string(rune('a'+i)), i)
+	}
+
+	replicas[0].Close()
+	replicas[1].Close()
+	assert(t, bus.published() == 0, "Eviction was published")
+}
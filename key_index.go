@@ -0,0 +1,163 @@
+package multicache
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Finding keys by prefix or pattern, for hierarchical keys such as
+"org/7/project/3/settings". Without the key index every key is scanned, see
+EnableKeyIndex.
+**/
+
+/**
+Keeps the cache's string keys in a radix tree, so KeysWithPrefix,
+RemoveByPrefix and the pattern functions only visit keys under the prefix
+instead of every key. Adds and removals update the tree, which costs a little
+time and memory per key.
+
+It must be called before the cache is shared between goroutines.
+**/
+func (mc *Multicache) EnableKeyIndex() {
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	mc.keyIndex = &radixTree{}
+	for key := range mc.kvStore {
+		mc.keyIndex.insert(key)
+	}
+}
+
+// Returns the keys starting with prefix in order.
+func (mc *Multicache) KeysWithPrefix(prefix string) []string {
+	mc.readLock()
+	defer mc.lock.RUnlock()
+
+	keys := []string{}
+	mc.walkPrefix(prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	return keys
+}
+
+/**
+Removes every item with a key starting with prefix, returning how many were
+removed. Removed items are reported to the RemoveListener like Remove.
+**/
+func (mc *Multicache) RemoveByPrefix(prefix string) int {
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	return mc.removeKeys(func(fn func(key string) bool) {
+		mc.walkPrefix(prefix, fn)
+	})
+}
+
+/**
+Returns the keys matching the shell pattern in order, using the syntax of
+path.Match so * doesn't match /. Only keys starting with the part of the
+pattern before its first special character are checked.
+**/
+func (mc *Multicache) KeysMatching(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	mc.readLock()
+	defer mc.lock.RUnlock()
+
+	keys := []string{}
+	mc.walkPattern(pattern, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	return keys, nil
+}
+
+// Like RemoveByPrefix but removes items with a key matching the pattern, see
+// KeysMatching.
+func (mc *Multicache) RemoveMatching(pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	return mc.removeKeys(func(fn func(key string) bool) {
+		mc.walkPattern(pattern, fn)
+	}), nil
+}
+
+// Removes the items of the keys walk finds, call with the exclusive lock.
+func (mc *Multicache) removeKeys(walk func(fn func(key string) bool)) int {
+	// Removing items edits the index so find them all first
+	items := []*MulticacheItem{}
+	seen := make(map[*MulticacheItem]bool)
+	walk(func(key string) bool {
+		item := mc.kvStore[key]
+		if !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+
+		return true
+	})
+
+	for _, item := range items {
+		mc.notifyRemoved(item.keys)
+		mc.removeItem(item, RemoveExplicit)
+	}
+
+	return len(items)
+}
+
+// Calls fn with the keys starting with prefix in order, using the index if
+// there is one.
+func (mc *Multicache) walkPrefix(prefix string, fn func(key string) bool) {
+	if mc.keyIndex != nil {
+		mc.keyIndex.walkPrefix(prefix, fn)
+		return
+	}
+
+	keys := []string{}
+	for key := range mc.kvStore {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !fn(key) {
+			return
+		}
+	}
+}
+
+// Calls fn with the keys matching a valid pattern in order.
+func (mc *Multicache) walkPattern(pattern string, fn func(key string) bool) {
+	literal := pattern
+	if index := strings.IndexAny(pattern, `*?[\`); index >= 0 {
+		literal = pattern[:index]
+	}
+
+	mc.walkPrefix(literal, func(key string) bool {
+		if matched, _ := path.Match(pattern, key); matched {
+			return fn(key)
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,94 @@
+package multicache
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func newKeyIndexTestCache(indexed bool) *Multicache {
+	mc, _ := NewDefaultMulticache(10)
+	mc.Add("org/7/project/3/settings", 1)
+	mc.AddMany(2, "org/7/project/3/members", "members:3")
+	mc.Add("org/7/project/4/settings", 3)
+	mc.Add("org/8/project/1/settings", 4)
+
+	if indexed {
+		mc.EnableKeyIndex()
+	}
+
+	return mc
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		mc := newKeyIndexTestCache(indexed)
+
+		keys := mc.KeysWithPrefix("org/7/project/3/")
+		assert(t, reflect.DeepEqual(keys, []string{"org/7/project/3/members", "org/7/project/3/settings"}), "Wrong keys for prefix")
+		assert(t, len(mc.KeysWithPrefix("")) == 5, "Empty prefix doesn't match every key")
+		assert(t, len(mc.KeysWithPrefix("org/9")) == 0, "Keys found for missing prefix")
+
+		removed := 0
+		mc.SetRemoveListener(func(keys []string) {
+			removed++
+		})
+
+		assert(t, mc.RemoveByPrefix("org/7/") == 3, "Wrong number of items removed")
+		assert(t, removed == 3, "Removals not reported")
+
+		// Aliases outside the prefix go with their item
+		_, ok := mc.Get("members:3")
+		assert(t, !ok, "Alias kept")
+		assert(t, reflect.DeepEqual(mc.KeysWithPrefix(""), []string{"org/8/project/1/settings"}), "Wrong keys left")
+	}
+}
+
+func TestKeysMatching(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		mc := newKeyIndexTestCache(indexed)
+
+		keys, err := mc.KeysMatching("org/*/project/*/settings")
+		assert(t, err == nil && len(keys) == 3, "Wrong keys for pattern")
+
+		keys, _ = mc.KeysMatching("org/7/project/[34]/s*")
+		assert(t, reflect.DeepEqual(keys, []string{"org/7/project/3/settings", "org/7/project/4/settings"}), "Wrong keys for class")
+
+		// * stops at /
+		keys, _ = mc.KeysMatching("org/*")
+		assert(t, len(keys) == 0, "* matched a /")
+
+		_, err = mc.KeysMatching("org/[")
+		assert(t, err == path.ErrBadPattern, "Bad pattern accepted")
+
+		count, err := mc.RemoveMatching("org/7/project/*/settings")
+		assert(t, err == nil && count == 2, "Wrong number of items removed")
+		_, ok := mc.Get("members:3")
+		assert(t, ok, "Item without a matching key removed")
+	}
+}
+
+func TestKeyIndexFollowsCache(t *testing.T) {
+	mc, _ := NewMulticache(2, &RoundRobin{})
+	mc.EnableKeyIndex()
+
+	mc.Add("a/1", 1)
+	mc.Add("a/2", 2)
+	mc.Add("a/3", 3)
+	assert(t, reflect.DeepEqual(mc.KeysWithPrefix("a/"), []string{"a/2", "a/3"}), "Evicted key still indexed")
+
+	mc.AddMany(4, "a/3", "b/1")
+	mc.Remove("a/2")
+	assert(t, reflect.DeepEqual(mc.KeysWithPrefix(""), []string{"a/3", "b/1"}), "Index out of step")
+
+	mc.Purge()
+	assert(t, len(mc.KeysWithPrefix("")) == 0 && mc.keyIndex.size == 0, "Purge left keys")
+}
@@ -0,0 +1,208 @@
+package multicache
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Keys that aren't strings. []byte keys are the same as the string keys holding
+the same bytes, but don't have to be converted for a Get. Other keys implement
+Key and are kept apart from string keys, so IntKey(1) and "1" are different
+keys.
+**/
+
+/**
+Key is implemented by comparable values to use as cache keys, such as structs
+of several IDs, so they don't have to be formatted into strings. K is the type
+implementing Key, so Equal doesn't need a conversion:
+
+	type userKey struct{ tenant, user int64 }
+
+	func (k userKey) Hash() uint64 { return uint64(k.tenant)*31 + uint64(k.user) }
+	func (k userKey) Equal(other userKey) bool { return k == other }
+
+	multicache.AddKey(mc, userKey{1, 42}, value)
+	value, ok := multicache.GetKey(mc, userKey{1, 42})
+
+Keys that are Equal must have the same Hash. Keys of different types are never
+equal.
+**/
+type Key[K any] interface {
+	Hash() uint64
+	Equal(other K) bool
+}
+
+// IntKey is a Key for integer IDs.
+type IntKey int64
+
+func (k IntKey) Hash() uint64 {
+	// The splitmix64 finalizer, spreads consecutive IDs
+	hash := uint64(k)
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
+
+func (k IntKey) Equal(other IntKey) bool {
+	return k == other
+}
+
+// FNV-1a of a string or byte key, written out so hashing doesn't allocate.
+// Keys held as bytes hash the same as the equal string without being
+// converted.
+func hashKey[K string | []byte](key K) uint64 {
+	const offset, prime = 14695981039346656037, 1099511628211
+
+	hash := uint64(offset)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime
+	}
+
+	return hash
+}
+
+// A Key stored in a MulticacheItem.
+type hashedKey struct {
+	hash uint64
+	key  interface{}
+}
+
+// Fetches an item from the cache by a Key, like Get it doesn't allocate.
+func GetKey[K Key[K]](mc *Multicache, key K) (value interface{}, ok bool) {
+	exclusive := mc.lockForGet()
+	value, ok, full := mc.access(findKey(mc, key))
+	mc.unlockForGet(exclusive)
+
+	if full {
+		mc.tryDrainAccesses()
+	}
+
+	return value, ok
+}
+
+/**
+Adds an item to the cache with the given Key. A RemoveListener is passed no
+keys when the item is removed.
+**/
+func AddKey[K Key[K]](mc *Multicache, key K, value interface{}) {
+	AddManyKeys(mc, value, key)
+}
+
+/* Adds an item to the cache with the given Keys
+
+NOTE: do not include duplicate keys, like AddMany.
+*/
+func AddManyKeys[K Key[K]](mc *Multicache, value interface{}, keys ...K) {
+	// Do nothing on empty key
+	if len(keys) == 0 {
+		return
+	}
+
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	mc.drainAccesses()
+
+	cacheItem := mc.getItem()
+	cacheItem.value = value
+
+	for _, key := range keys {
+		// Remove old references if they exist.
+		if item := findKey(mc, key); item != nil {
+			mc.removeItem(item, RemoveOverwritten)
+		}
+
+		hash := key.Hash()
+		cacheItem.hashedKeys = append(cacheItem.hashedKeys, hashedKey{hash: hash, key: key})
+		mc.hashed[hash] = append(mc.hashed[hash], cacheItem)
+	}
+
+	mc.policy.OnInsert(cacheItem.slot, cacheItem.keys)
+}
+
+// Removes the item with the given Key from the multicache
+func RemoveKey[K Key[K]](mc *Multicache, key K) {
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	if item := findKey(mc, key); item != nil {
+		mc.notifyRemoved(item.keys)
+		mc.removeItem(item, RemoveExplicit)
+	}
+}
+
+// Finds the item holding key, nil if there isn't one. Call with the lock held.
+func findKey[K Key[K]](mc *Multicache, key K) *MulticacheItem {
+	hash := key.Hash()
+
+	for _, item := range mc.hashed[hash] {
+		for _, stored := range item.hashedKeys {
+			if stored.hash != hash {
+				continue
+			}
+
+			if storedKey, ok := stored.key.(K); ok && key.Equal(storedKey) {
+				return item
+			}
+		}
+	}
+
+	return nil
+}
+
+// Drops item from the items with the given hash.
+func (mc *Multicache) unindexHashed(hash uint64, item *MulticacheItem) {
+	items := mc.hashed[hash]
+	for i := 0; i < len(items); i++ {
+		if items[i] == item {
+			items[i] = items[len(items)-1]
+			items = items[:len(items)-1]
+			i--
+		}
+	}
+
+	if len(items) == 0 {
+		delete(mc.hashed, hash)
+	} else {
+		mc.hashed[hash] = items
+	}
+}
+
+// Fetches an item from the cache by a []byte key without converting it.
+func (mc *Multicache) GetBytes(key []byte) (value interface{}, ok bool) {
+	exclusive := mc.lockForGet()
+	value, ok, full := mc.access(mc.kvStore[string(key)])
+	mc.unlockForGet(exclusive)
+
+	if full {
+		mc.tryDrainAccesses()
+	}
+
+	return value, ok
+}
+
+// Adds an item to the cache with the given []byte key
+func (mc *Multicache) AddBytes(key []byte, value interface{}) {
+	mc.Add(string(key), value)
+}
+
+// Adds an item to the cache with the given []byte keys, see AddMany.
+func (mc *Multicache) AddManyBytes(value interface{}, keys ...[]byte) {
+	stringKeys := make([]string, len(keys))
+	for i, key := range keys {
+		stringKeys[i] = string(key)
+	}
+
+	mc.AddMany(value, stringKeys...)
+}
+
+// Removes the item with the given []byte key from the multicache
+func (mc *Multicache) RemoveBytes(key []byte) {
+	mc.Remove(string(key))
+}
@@ -0,0 +1,125 @@
+package multicache
+
+import (
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+type tenantKey struct {
+	tenant, user int64
+}
+
+// Every tenantKey collides so lookups have to use Equal.
+func (k tenantKey) Hash() uint64 {
+	return 7
+}
+
+func (k tenantKey) Equal(other tenantKey) bool {
+	return k == other
+}
+
+func TestBytesKeys(t *testing.T) {
+	mc, _ := NewDefaultMulticache(4)
+
+	mc.AddBytes([]byte("a"), 1)
+	value, ok := mc.Get("a")
+	assert(t, ok && value == 1, "[]byte key isn't the same as the string")
+
+	mc.AddManyBytes(2, []byte("b"), []byte("c"))
+	value, ok = mc.GetBytes([]byte("c"))
+	assert(t, ok && value == 2, "[]byte alias missing")
+
+	mc.RemoveBytes([]byte("b"))
+	_, ok = mc.GetBytes([]byte("c"))
+	assert(t, !ok, "Item kept after removal")
+}
+
+func TestKeys(t *testing.T) {
+	mc, _ := NewMulticache(4, &RoundRobin{})
+
+	AddKey(mc, IntKey(1), "int")
+	mc.Add("1", "string")
+
+	value, ok := GetKey(mc, IntKey(1))
+	assert(t, ok && value == "int", "Int key missing")
+	value, _ = mc.Get("1")
+	assert(t, value == "string", "Int key and string key mixed up")
+
+	AddManyKeys(mc, "both", tenantKey{1, 42}, tenantKey{2, 42})
+	value, ok = GetKey(mc, tenantKey{2, 42})
+	assert(t, ok && value == "both", "Colliding struct key missing")
+	_, ok = GetKey(mc, tenantKey{3, 42})
+	assert(t, !ok, "Colliding struct key found another item")
+
+	// Overwriting one key drops the item for every key
+	AddKey(mc, tenantKey{1, 42}, "new")
+	_, ok = GetKey(mc, tenantKey{2, 42})
+	assert(t, !ok, "Overwritten item kept")
+	assert(t, mc.Len() == 3, "Wrong number of items")
+
+	RemoveKey(mc, IntKey(1))
+	_, ok = GetKey(mc, IntKey(1))
+	assert(t, !ok, "Removed key found")
+	_, ok = mc.Get("1")
+	assert(t, ok, "Removing an int key removed the string key")
+}
+
+func TestKeysEvicted(t *testing.T) {
+	mc, _ := NewMulticache(2, &RoundRobin{})
+
+	for i := 0; i < 100; i++ {
+		AddKey(mc, IntKey(i), i)
+	}
+
+	value, ok := GetKey(mc, IntKey(99))
+	assert(t, ok && value == 99, "Newest item missing")
+	_, ok = GetKey(mc, IntKey(0))
+	assert(t, !ok, "Evicted item found")
+	assert(t, len(mc.hashed) == 2, "Evicted keys left in the index")
+
+	mc.Purge()
+	assert(t, len(mc.hashed) == 0, "Purge left keys in the index")
+}
+
+func TestRemoveKeyListener(t *testing.T) {
+	mc, _ := NewMulticache(4, &RoundRobin{})
+
+	var removed [][]string
+	mc.SetRemoveListener(func(keys []string) {
+		removed = append(removed, keys)
+	})
+
+	AddKey(mc, IntKey(1), "int")
+	RemoveKey(mc, IntKey(1))
+	assert(t, len(removed) == 0, "Removing a hashed key reported as a purge")
+
+	mc.Add("a", 1)
+	mc.Remove("a")
+	assert(t, len(removed) == 1 && len(removed[0]) == 1 && removed[0][0] == "a", "String key removal not reported")
+}
+
+func TestGetDoesNotAllocate(t *testing.T) {
+	for _, algorithm := range []ReplacementAlgorithm{&LeastRecentlyUsed{}, &SecondChance{}, &RoundRobin{}} {
+		mc, _ := NewMulticache(8, algorithm)
+		mc.Add("string", 1)
+		AddKey(mc, IntKey(2), 2)
+		AddKey(mc, tenantKey{3, 3}, 3)
+
+		byteKey := []byte("string")
+		allocs := testing.AllocsPerRun(100, func() {
+			mc.Get("string")
+			mc.GetBytes(byteKey)
+			GetKey(mc, IntKey(2))
+			GetKey(mc, tenantKey{3, 3})
+		})
+
+		assert(t, allocs == 0, "Get allocated")
+	}
+}
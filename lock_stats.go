@@ -0,0 +1,66 @@
+package multicache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// How long callers have waited for a Multicache's lock.
+type LockStats struct {
+	// Lock acquisitions that had to wait for another goroutine
+	Contended uint64
+	// Total time spent waiting
+	Wait time.Duration
+}
+
+/**
+Starts recording how long callers wait for the cache's lock, returned by
+LockStats. Acquisitions that don't have to wait cost nothing extra, the rest
+are timed.
+
+It must be called before the cache is shared between goroutines.
+**/
+func (mc *Multicache) EnableLockStats() {
+	mc.timeLocks = true
+}
+
+// Returns the time spent waiting for the lock since EnableLockStats.
+func (mc *Multicache) LockStats() LockStats {
+	return LockStats{
+		Contended: atomic.LoadUint64(&mc.lockWaits),
+		Wait:      time.Duration(atomic.LoadInt64(&mc.lockWaitNanos)),
+	}
+}
+
+func (mc *Multicache) writeLock() {
+	if !mc.timeLocks {
+		mc.lock.Lock()
+	} else if !mc.lock.TryLock() {
+		start := time.Now()
+		mc.lock.Lock()
+		mc.recordLockWait(start)
+	}
+}
+
+func (mc *Multicache) readLock() {
+	if !mc.timeLocks {
+		mc.lock.RLock()
+	} else if !mc.lock.TryRLock() {
+		start := time.Now()
+		mc.lock.RLock()
+		mc.recordLockWait(start)
+	}
+}
+
+func (mc *Multicache) recordLockWait(start time.Time) {
+	atomic.AddUint64(&mc.lockWaits, 1)
+	atomic.AddInt64(&mc.lockWaitNanos, int64(time.Since(start)))
+}
@@ -20,6 +20,10 @@ min-heap because the items of Multicache are all in an array and will be paged
 together, using a min heap may actually cause cache thrashing whereas a
 sequential scan should not and *should* be taken care of by the processor
 automatically prefetching the next page before it is needed.
+
+Gets are buffered, see BufferedRetriever, so they only take the read lock. When
+many goroutines Get at once some uses may be missed, making the order
+approximate.
 **/
 type LeastRecentlyUsed struct {
 	counter int64
@@ -55,3 +59,7 @@ func (rof *LeastRecentlyUsed) ItemRetrieved(item *MulticacheItem) bool {
 	item.Tag = rof.counter
 	return true
 }
+
+func (rof *LeastRecentlyUsed) BuffersRetrievals() bool {
+	return true
+}
@@ -19,13 +19,46 @@ var (
 
 type Multicache struct {
 	kvStore         map[string]*MulticacheItem
+	hashed          map[uint64][]*MulticacheItem // items by Key hash, see AddKey
+	tagged          map[string]map[*MulticacheItem]struct{}
+	keyIndex        *radixTree // nil unless EnableKeyIndex is called
 	itemList        []*MulticacheItem
 	cacheSize       uint64
-	replace         ReplacementAlgorithm
+	replace         ReplacementAlgorithm // nil for NewMulticacheV2
+	policy          ReplacementAlgorithmV2
 	lock            sync.RWMutex
 	retrieveUpdates bool
+	removeListener  RemoveListener
+	namespaces      map[string]*Namespace
+
+	// Records Gets for algorithms that buffer accesses, nil otherwise.
+	accesses *accessBuffer
+
+	// Slots emptied by Remove, RemoveManyFunc or an overwriting Add, which
+	// add fills before asking the algorithm for a victim. It may hold slots
+	// that have been filled since, see MulticacheItem.free.
+	freeSlots []Slot
+
+	// See EnableLockStats, the counters are updated atomically.
+	timeLocks     bool
+	lockWaits     uint64
+	lockWaitNanos int64
 }
 
+/** RemoveListener is told about items that are explicitly removed from the
+cache. Remove and RemoveManyFunc pass every key of each removed item and Purge
+passes nil. Items replaced by the ReplacementAlgorithm or overwritten by a new
+Add are not reported, nor are items that only have keys added with AddKey.
+
+Keys that change items without an item being removed are reported too:
+UnlinkKey passes the key it drops and AddAlias the keys it adds, so anything
+held elsewhere under those keys can be invalidated.
+
+The listener is called with the cache locked so, like a ReplacementAlgorithm,
+it must not call any functions of the Multicache.
+**/
+type RemoveListener func(keys []string)
+
 // Creates a new multicache that can hold the given number of items.
 // The default algorithm used is SecondChance
 func NewDefaultMulticache(numItems uint64) (*Multicache, error) {
@@ -34,33 +67,60 @@ func NewDefaultMulticache(numItems uint64) (*Multicache, error) {
 }
 
 // Creates a multicache that can hold the given number of items using the given
-// replacement algorithm. You should use CalculateHitMiss to look for the best
-// ReplacementAlgorithm for your specific data.
+// replacement algorithm. You should use Recommend or CalculateHitMiss to look
+// for the best ReplacementAlgorithm and size for your specific data.
 func NewMulticache(numItems uint64, algorithm ReplacementAlgorithm) (*Multicache, error) {
 	if numItems == 0 {
 		return nil, InvalidSizeError
 	}
 
+	mc := newMulticache(numItems)
+	mc.replace = algorithm
+	mc.start(&algorithmAdapter{algorithm: algorithm, mc: mc})
+
+	return mc, nil
+}
+
+// Creates a multicache that can hold the given number of items using an
+// algorithm written for ReplacementAlgorithmV2.
+func NewMulticacheV2(numItems uint64, algorithm ReplacementAlgorithmV2) (*Multicache, error) {
+	if numItems == 0 {
+		return nil, InvalidSizeError
+	}
+
+	mc := newMulticache(numItems)
+	mc.start(algorithm)
+
+	return mc, nil
+}
+
+func newMulticache(numItems uint64) *Multicache {
 	var mc Multicache
 	mc.kvStore = make(map[string]*MulticacheItem)
 	mc.itemList = make([]*MulticacheItem, numItems)
 
 	for i, _ := range mc.itemList {
-		mc.itemList[i] = new(MulticacheItem)
+		mc.itemList[i] = &MulticacheItem{slot: Slot(i)}
 	}
 
 	mc.cacheSize = numItems
-	mc.replace = algorithm
-	mc.retrieveUpdates = algorithm.UpdatesOnRetrieved()
+	return &mc
+}
 
-	mc.Purge()
+func (mc *Multicache) start(policy ReplacementAlgorithmV2) {
+	mc.policy = policy
+	mc.retrieveUpdates = policy.UpdatesOnAccess()
 
-	return &mc, nil
+	if buffered, ok := policy.(AccessBuffering); ok && mc.retrieveUpdates && buffered.BuffersAccesses() {
+		mc.accesses = newAccessBuffer()
+	}
+
+	mc.Purge()
 }
 
 // Adds an item to the cache with the given key
 func (mc *Multicache) Add(key string, value interface{}) {
-	mc.lock.Lock()
+	mc.writeLock()
 	defer mc.lock.Unlock()
 
 	mc.add(value, key)
@@ -72,19 +132,23 @@ NOTE: do not include duplicate keys in AddMany e.g. AddMany("foo", "bar", "baz",
 this will caused undefined results.
 */
 func (mc *Multicache) AddMany(value interface{}, keys ...string) {
-	mc.lock.Lock()
+	mc.writeLock()
 	defer mc.lock.Unlock()
 
 	mc.add(value, keys...)
 }
 
-// Adds an item to the cache with the given keys
-func (mc *Multicache) add(value interface{}, keys ...string) {
+// Adds an item to the cache with the given keys, returning the item or nil if
+// there are no keys.
+func (mc *Multicache) add(value interface{}, keys ...string) *MulticacheItem {
 	// Do nothing on empty key
 	if len(keys) == 0 {
-		return
+		return nil
 	}
 
+	// The algorithm needs to know about recent Gets before picking a victim
+	mc.drainAccesses()
+
 	cacheItem := mc.getItem()
 
 	cacheItem.value = value
@@ -94,26 +158,72 @@ func (mc *Multicache) add(value interface{}, keys ...string) {
 		// Remove old references if they exist.
 		item, ok := mc.kvStore[key]
 		if ok {
-			mc.removeItem(item)
+			mc.removeItem(item, RemoveOverwritten)
 		}
 
 		mc.kvStore[key] = cacheItem
+		if mc.keyIndex != nil {
+			mc.keyIndex.insert(key)
+		}
 	}
+
+	mc.policy.OnInsert(cacheItem.slot, keys)
+	return cacheItem
 }
 
 // Fetches an item from the cache
 func (mc *Multicache) Get(key string) (value interface{}, ok bool) {
+	exclusive := mc.lockForGet()
+	value, ok, full := mc.access(mc.kvStore[key])
+	mc.unlockForGet(exclusive)
+
+	if full {
+		mc.tryDrainAccesses()
+	}
+
+	return value, ok
+}
+
+// Takes the lock Get needs, returning true if it's the exclusive lock.
+func (mc *Multicache) lockForGet() (exclusive bool) {
 	// If the caching algorithm updates some state when a get is done
 	// do a normal lock, otherwise do a multiple reader lock for speed.
-	if mc.retrieveUpdates {
-		mc.lock.Lock()
-		defer mc.lock.Unlock()
+	if mc.retrieveUpdates && mc.accesses == nil {
+		mc.writeLock()
+		return true
+	}
+
+	mc.readLock()
+	return false
+}
+
+func (mc *Multicache) unlockForGet(exclusive bool) {
+	if exclusive {
+		mc.lock.Unlock()
 	} else {
-		mc.lock.RLock()
-		defer mc.lock.RUnlock()
+		mc.lock.RUnlock()
+	}
+}
+
+/**
+Tells the algorithm an item found by Get was used, returning its value if it
+can be returned. full is true if the access was buffered and the buffers
+should be drained once the lock is released. item may be nil for a miss.
+**/
+func (mc *Multicache) access(item *MulticacheItem) (value interface{}, ok, full bool) {
+	if item == nil {
+		return nil, false, false
+	}
+
+	if mc.accesses != nil {
+		return item.value, true, mc.accesses.record(item)
 	}
 
-	return mc.get(key)
+	if !mc.policy.OnAccess(item.slot) {
+		return nil, false, false
+	}
+
+	return item.value, true, false
 }
 
 // This get function does no locking so it can be used elsewhere.
@@ -123,7 +233,7 @@ func (mc *Multicache) get(key string) (value interface{}, ok bool) {
 		return nil, false
 	}
 
-	ok = mc.replace.ItemRetrieved(v)
+	ok = mc.policy.OnAccess(v.slot)
 	if !ok {
 		return nil, false
 	}
@@ -156,7 +266,7 @@ will return a nil item and the error returned by GetOrFindMiss.
 func (mc *Multicache) GetOrFind(key string, replaceFunc GetOrFindMiss) (item interface{}, err error) {
 	// Do a full write lock because we don't want a race condition in case we
 	// need to write.
-	mc.lock.Lock()
+	mc.writeLock()
 	defer mc.lock.Unlock()
 
 	// Try to get the item, on success return it
@@ -178,66 +288,164 @@ func (mc *Multicache) GetOrFind(key string, replaceFunc GetOrFindMiss) (item int
 
 // Removes an item from the multicache
 func (mc *Multicache) Remove(key string) {
-	mc.lock.Lock()
+	mc.writeLock()
 	defer mc.lock.Unlock()
 
 	item, ok := mc.kvStore[key]
 	if ok {
-		mc.removeItem(item)
+		mc.notifyRemoved(item.keys)
+		mc.removeItem(item, RemoveExplicit)
 	}
 }
 
 // Iterates through the valid items in the cache, passing them to the removal function.
 // The function returns true if the item is to be removed, or false if it is not.
 func (mc *Multicache) RemoveManyFunc(removeFunc func(item interface{}) (shouldRemove bool)) {
-	mc.lock.Lock()
+	mc.writeLock()
 	defer mc.lock.Unlock()
 
 	for _, item := range mc.itemList {
 		// Ignore all items that are unreachable
-		if len(item.keys) == 0 {
+		if item.empty() {
 			continue
 		}
 
 		shouldRemove := removeFunc(item.value)
 
 		if shouldRemove {
-			mc.removeItem(item)
+			mc.notifyRemoved(item.keys)
+			mc.removeItem(item, RemoveExplicit)
 		}
 	}
 }
 
 // Removes all items from the cache.
 func (mc *Multicache) Purge() {
-	mc.lock.Lock()
+	mc.writeLock()
 	defer mc.lock.Unlock()
 
 	mc.kvStore = make(map[string]*MulticacheItem)
+	mc.hashed = make(map[uint64][]*MulticacheItem)
+	mc.tagged = make(map[string]map[*MulticacheItem]struct{})
+	if mc.keyIndex != nil {
+		mc.keyIndex = &radixTree{}
+	}
+	mc.freeSlots = mc.freeSlots[:0]
+	if mc.accesses != nil {
+		mc.accesses.clear()
+	}
 
 	for _, item := range mc.itemList {
 		item.reset()
 	}
 
-	mc.replace.Reset(mc)
+	for _, namespace := range mc.namespaces {
+		namespace.clear()
+	}
+
+	mc.policy.Reset(len(mc.itemList))
+	if mc.removeListener != nil {
+		mc.removeListener(nil)
+	}
 }
 
-// Removes an item from the cache.
-func (mc *Multicache) removeItem(item *MulticacheItem) {
+// Sets the function told about explicit removals, nil turns it off.
+func (mc *Multicache) SetRemoveListener(listener RemoveListener) {
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	mc.removeListener = listener
+}
+
+// Passes the keys of an explicitly removed item to the listener if there is
+// one. removeItem replaces item.keys so the slice is safe to hand out. Items
+// with only hashed keys have nothing to report, and an empty list would be
+// taken for a Purge.
+func (mc *Multicache) notifyRemoved(keys []string) {
+	if mc.removeListener != nil && len(keys) > 0 {
+		mc.removeListener(keys)
+	}
+}
+
+// Returns the maximum number of items the cache can hold.
+func (mc *Multicache) Capacity() uint64 {
+	return mc.cacheSize
+}
+
+// Returns the number of items currently stored in the cache. An item added
+// with several keys counts once.
+func (mc *Multicache) Len() int {
+	mc.readLock()
+	defer mc.lock.RUnlock()
+
+	count := 0
+	for _, item := range mc.itemList {
+		if !item.empty() {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Removes an item from the cache, telling the algorithm why if the slot held
+// an item.
+func (mc *Multicache) removeItem(item *MulticacheItem, reason RemoveReason) {
+	if item.empty() {
+		item.softReset()
+		return
+	}
+
 	// Remove all references to this item.
 	for _, v := range item.keys {
 		delete(mc.kvStore, v)
+		if mc.keyIndex != nil {
+			mc.keyIndex.delete(v)
+		}
+	}
+
+	for _, key := range item.hashedKeys {
+		mc.unindexHashed(key.hash, item)
+	}
+
+	for _, tag := range item.tags {
+		mc.untag(tag, item)
+	}
+
+	if item.namespace != nil {
+		item.namespace.removed(item, reason)
 	}
 
+	mc.policy.OnRemove(item.slot, reason)
 	item.softReset()
+
+	// Evicted slots are filled straight away, others are free to reuse.
+	if reason != RemoveEvicted {
+		item.free = true
+		mc.freeSlots = append(mc.freeSlots, item.slot)
+	}
 }
 
-// Grabs and clears an item to be filled according to the replacement algorithm
+// Grabs and clears an item to be filled, a free slot if there is one and
+// otherwise one chosen by the replacement algorithm. add tells the algorithm
+// once the item is filled.
 func (mc *Multicache) getItem() *MulticacheItem {
-	item := mc.replace.GetNextReplacement(mc)
+	for len(mc.freeSlots) > 0 {
+		slot := mc.freeSlots[len(mc.freeSlots)-1]
+		mc.freeSlots = mc.freeSlots[:len(mc.freeSlots)-1]
+
+		// Skip slots the algorithm has chosen since they were freed
+		if item := mc.itemList[slot]; item.free {
+			item.free = false
+			return item
+		}
+	}
+
+	item := mc.itemList[mc.policy.Victim()]
+	item.free = false
 
 	// Remove all references to this item.
-	mc.removeItem(item)
+	mc.removeItem(item, RemoveEvicted)
 
-	mc.replace.InitItem(item)
 	return item
 }
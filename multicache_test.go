@@ -1,6 +1,11 @@
 package multicache
 
-import "testing"
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
 
 /**
 This file is part of multicache, a library for handling caches with multiple
@@ -153,3 +158,229 @@ func TestNewMulticachePurge(t *testing.T) {
 	_, ok = mc.Get("key")
 	assert(t, ok == false, "Got key after purge")
 }
+
+func TestMulticacheLenCapacity(t *testing.T) {
+	mc, _ := NewDefaultMulticache(3)
+
+	assert(t, mc.Capacity() == 3, "Wrong capacity")
+	assert(t, mc.Len() == 0, "New cache not empty")
+
+	mc.Add("key", "value")
+	mc.AddMany("value2", "key2-1", "key2-2")
+	assert(t, mc.Len() == 2, "Multikey item counted more than once")
+
+	mc.Remove("key2-2")
+	assert(t, mc.Len() == 1, "Removed item still counted")
+
+	mc.Purge()
+	assert(t, mc.Len() == 0, "Purged cache not empty")
+}
+
+func TestRemoveListener(t *testing.T) {
+	mc, _ := NewMulticache(2, &RoundRobin{})
+
+	removed := [][]string{}
+	mc.SetRemoveListener(func(keys []string) {
+		removed = append(removed, keys)
+	})
+
+	mc.AddMany("value", "a", "b")
+	mc.Add("c", "value2")
+	mc.Remove("b")
+	mc.Remove("missing")
+	assert(t, len(removed) == 1, "Wrong number of removals reported")
+	assert(t, len(removed) == 1 && len(removed[0]) == 2, "Didn't report all keys of the item")
+
+	// Evictions aren't reported
+	mc.Add("d", "value3")
+	mc.Add("e", "value4")
+	assert(t, len(removed) == 1, "Eviction reported as a removal")
+
+	mc.RemoveManyFunc(func(item interface{}) bool {
+		return item == "value3"
+	})
+	assert(t, len(removed) == 2 && removed[1][0] == "d", "RemoveManyFunc removal not reported")
+
+	mc.Purge()
+	assert(t, len(removed) == 3 && removed[2] == nil, "Purge not reported")
+
+	mc.SetRemoveListener(nil)
+	mc.Purge()
+	assert(t, len(removed) == 3, "Listener called after being removed")
+}
+
+func TestLockStats(t *testing.T) {
+	mc, _ := NewDefaultMulticache(10)
+	mc.EnableLockStats()
+
+	mc.writeLock()
+	done := make(chan bool)
+	go func() {
+		mc.Add("a", 1)
+		done <- true
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	mc.lock.Unlock()
+	<-done
+
+	stats := mc.LockStats()
+	assert(t, stats.Contended == 1, "Contended acquisition not counted")
+	assert(t, stats.Wait >= 5*time.Millisecond, "Wait not timed")
+
+	mc.Get("a")
+	assert(t, mc.LockStats().Contended == 1, "Uncontended acquisition counted")
+}
+
+func TestFreeSlotReuse(t *testing.T) {
+	const size, removed = 10, 4
+
+	for _, algorithm := range RegisteredAlgorithms() {
+		mc, _ := NewMulticache(size, algorithm.New())
+
+		// Some algorithms such as Random can replace items before every
+		// empty slot is used, so keep going until the cache is full.
+		for i := 0; mc.Len() < size; i++ {
+			mc.Add(strconv.Itoa(i), i)
+		}
+
+		keys := []string{}
+		for key := range mc.kvStore {
+			keys = append(keys, key)
+		}
+
+		for _, key := range keys[:removed] {
+			mc.Remove(key)
+		}
+
+		for i := 0; i < removed; i++ {
+			mc.Add("new"+strconv.Itoa(i), i)
+		}
+
+		// Nothing was evicted
+		for _, key := range keys[removed:] {
+			_, ok := mc.Get(key)
+			assert(t, ok, algorithm.Name+" evicted an item while slots were free")
+		}
+
+		for i := 0; i < removed; i++ {
+			_, ok := mc.Get("new" + strconv.Itoa(i))
+			assert(t, ok, algorithm.Name+" lost a new item")
+		}
+
+		assert(t, mc.Len() == size, algorithm.Name+" isn't full")
+	}
+}
+
+func TestFreeSlotReuseAfterOverwrite(t *testing.T) {
+	mc, _ := NewMulticache(3, &RoundRobin{})
+	mc.Add("a", 1)
+	mc.Add("b", 2)
+	mc.Add("c", 3)
+
+	// Replaces the items of a and b with one, freeing a slot
+	mc.AddMany(4, "a", "b")
+	mc.Add("d", 5)
+
+	_, ok := mc.Get("c")
+	assert(t, ok, "Item evicted while a slot was free")
+	assert(t, mc.Len() == 3, "Cache isn't full")
+
+	// Free slots don't survive a purge
+	mc.Remove("c")
+	mc.Purge()
+	assert(t, len(mc.freeSlots) == 0 && mc.Len() == 0, "Purge kept free slots")
+}
+
+func TestFreeSlotsRecentlyUsed(t *testing.T) {
+	mc, _ := NewMulticache(3, &LeastRecentlyUsed{})
+	mc.Add("a", 1)
+	mc.Add("b", 2)
+	mc.Add("c", 3)
+
+	// d takes a's slot, it mustn't look as old as a did
+	mc.Remove("a")
+	mc.Add("d", 4)
+	mc.Add("e", 5)
+
+	_, ok := mc.Get("d")
+	assert(t, ok, "Item in a reused slot evicted first")
+	_, ok = mc.Get("b")
+	assert(t, !ok, "Least recently used item kept")
+}
+
+func TestFreeSlotsRoundRobinOrder(t *testing.T) {
+	original, _ := NewMulticache(3, &RoundRobin{})
+	ported, _ := NewMulticacheV2(3, &RoundRobinPolicy{})
+
+	for _, mc := range []*Multicache{original, ported} {
+		mc.Add("a", 1)
+		mc.Add("b", 2)
+		mc.Add("c", 3)
+
+		// d takes a's slot, b is still the oldest
+		mc.Remove("a")
+		mc.Add("d", 4)
+		mc.Add("e", 5)
+
+		_, ok := mc.Get("b")
+		assert(t, !ok, "Oldest item kept")
+		for _, key := range []string{"c", "d", "e"} {
+			_, ok := mc.Get(key)
+			assert(t, ok, "Newer item "+key+" replaced before the oldest")
+		}
+	}
+}
+
+func TestFreeSlotsUnreferenced(t *testing.T) {
+	for _, algorithm := range []ReplacementAlgorithm{&SecondChance{}, &Sieve{}} {
+		mc, _ := NewMulticache(3, algorithm)
+		mc.Add("a", 1)
+		mc.Add("b", 2)
+		mc.Add("c", 3)
+
+		// d takes a's slot without a reference, so it goes before b and c
+		// which were just used.
+		mc.Remove("a")
+		mc.Add("d", 4)
+		mc.Get("b")
+		mc.Get("c")
+		mc.Add("e", 5)
+
+		_, ok := mc.Get("d")
+		assert(t, !ok, fmt.Sprintf("%T kept an unreferenced item", algorithm))
+		for _, key := range []string{"b", "c", "e"} {
+			_, ok := mc.Get(key)
+			assert(t, ok, fmt.Sprintf("%T replaced referenced item %s", algorithm, key))
+		}
+	}
+}
+
+func TestVictimChosenFreeSlot(t *testing.T) {
+	// Random may pick a freed slot itself, which must then leave the free list
+	for seed := 0; seed < 50; seed++ {
+		mc, _ := NewMulticache(4, &Random{})
+		for i := 0; i < 20; i++ {
+			key := strconv.Itoa(i)
+			mc.Add(key, i)
+			if i%3 == 0 {
+				mc.Remove(strconv.Itoa(i / 2))
+			}
+		}
+
+		// Every key maps to the item holding it
+		for key, item := range mc.kvStore {
+			assert(t, containsString(item.keys, key), "Key points at an item that doesn't hold it")
+		}
+	}
+}
+
+func containsString(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
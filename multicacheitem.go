@@ -16,19 +16,50 @@ type MulticacheItem struct {
 	Tag int64
 	// The set of keys that reference this item.
 	keys []string
+	// Keys added with AddKey or AddManyKeys.
+	hashedKeys []hashedKey
+	// Tags given to AddTagged.
+	tags []string
 	// The actual item stored in this item.
 	value interface{}
+	// Where this item is in the cache's itemList, it never changes.
+	slot Slot
+	// True while the slot is empty and on the cache's free list
+	free bool
+	// The Namespace the item was added through and its size for the
+	// namespace's byte quota.
+	namespace *Namespace
+	size      int64
+	// Changes every time the slot is emptied so buffered accesses to an
+	// earlier item can be told apart.
+	generation uint32
 }
 
 // Resets the cache item to a blank slate
 func (m *MulticacheItem) reset() {
 	m.Tag = 0
 	m.keys = []string{}
+	m.hashedKeys = nil
+	m.tags = nil
+	m.namespace = nil
+	m.size = 0
 	m.value = nil
+	m.free = false
+	m.generation++
 }
 
 // Resets the cache item without clearing the Tag
 func (m *MulticacheItem) softReset() {
 	m.keys = []string{}
+	m.hashedKeys = nil
+	m.tags = nil
+	m.namespace = nil
+	m.size = 0
 	m.value = nil
+	m.generation++
+}
+
+// True if no key references the item.
+func (m *MulticacheItem) empty() bool {
+	return len(m.keys) == 0 && len(m.hashedKeys) == 0
 }
@@ -0,0 +1,293 @@
+package multicache
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// Separates a namespace's name from the keys added through it.
+const namespaceSeparator = "\x00"
+
+/**
+Namespace is a view of a Multicache for one tenant. Keys are prefixed with the
+namespace's name so tenants can use the same keys, and a quota keeps one tenant
+from taking over the cache: once a namespace is at its quota, adding to it
+replaces the namespace's own oldest items rather than other tenants' items.
+
+Items in a namespace are still replaced by the cache's algorithm like any
+other. The keys passed to a RemoveListener include the prefix.
+**/
+type Namespace struct {
+	mc     *Multicache
+	name   string
+	prefix string
+	quota  Quota
+
+	// Items added through the namespace, oldest first. Entries whose item
+	// has been removed since are skipped and dropped lazily.
+	queue []namespaceEntry
+	items int
+	bytes int64
+
+	hits           uint64
+	misses         uint64
+	evictions      uint64
+	quotaEvictions uint64
+}
+
+type namespaceEntry struct {
+	item       *MulticacheItem
+	generation uint32
+}
+
+/**
+Quota limits the share of the cache a Namespace can use, a zero field is no
+limit. Bytes needs Size to tell how big each value is, a value bigger than
+Bytes on its own is still stored.
+**/
+type Quota struct {
+	Items int
+	Bytes int64
+	Size  func(value interface{}) int64
+}
+
+// Statistics for a Namespace.
+type NamespaceStats struct {
+	// Items and bytes currently stored
+	Items int
+	Bytes int64
+	// Gets through the namespace since it was created
+	Hits   uint64
+	Misses uint64
+	// Items replaced by the cache's algorithm
+	Evictions uint64
+	// Items replaced to keep the namespace within its quota
+	QuotaEvictions uint64
+}
+
+/**
+Returns the namespace with the given name, creating it the first time. The
+name must not contain a NUL byte.
+**/
+func (mc *Multicache) Namespace(name string) *Namespace {
+	if strings.Contains(name, namespaceSeparator) {
+		panic("multicache: namespace name contains a NUL byte")
+	}
+
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	if mc.namespaces == nil {
+		mc.namespaces = make(map[string]*Namespace)
+	}
+
+	namespace, ok := mc.namespaces[name]
+	if !ok {
+		namespace = &Namespace{mc: mc, name: name, prefix: name + namespaceSeparator}
+		mc.namespaces[name] = namespace
+	}
+
+	return namespace
+}
+
+// Removes every item in the named namespace, leaving other items alone.
+func (mc *Multicache) PurgeNamespace(name string) {
+	mc.readLock()
+	namespace := mc.namespaces[name]
+	mc.lock.RUnlock()
+
+	if namespace != nil {
+		namespace.Purge()
+	}
+}
+
+// Returns the namespace's name.
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// Sets the namespace's quota, replacing items right away if it's over.
+func (ns *Namespace) SetQuota(quota Quota) {
+	ns.mc.writeLock()
+	defer ns.mc.lock.Unlock()
+
+	ns.quota = quota
+	ns.makeRoom(0, 0)
+}
+
+// Adds an item to the namespace with the given key
+func (ns *Namespace) Add(key string, value interface{}) {
+	ns.AddMany(value, key)
+}
+
+/* Adds an item to the namespace with the given keys
+
+NOTE: do not include duplicate keys, like Multicache.AddMany.
+*/
+func (ns *Namespace) AddMany(value interface{}, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = ns.prefix + key
+	}
+
+	var size int64
+	if ns.quota.Size != nil {
+		size = ns.quota.Size(value)
+	}
+
+	mc := ns.mc
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	// Items being overwritten don't count against the quota
+	for _, key := range prefixed {
+		if item, ok := mc.kvStore[key]; ok {
+			mc.removeItem(item, RemoveOverwritten)
+		}
+	}
+
+	ns.makeRoom(1, size)
+
+	item := mc.add(value, prefixed...)
+	item.namespace = ns
+	item.size = size
+
+	ns.items++
+	ns.bytes += size
+	ns.queue = append(ns.queue, namespaceEntry{item: item, generation: item.generation})
+}
+
+// Fetches an item from the namespace
+func (ns *Namespace) Get(key string) (value interface{}, ok bool) {
+	// Build the prefixed key on the stack where it fits
+	var buffer [64]byte
+	prefixed := append(append(buffer[:0], ns.prefix...), key...)
+
+	mc := ns.mc
+	exclusive := mc.lockForGet()
+	value, ok, full := mc.access(mc.kvStore[string(prefixed)])
+	mc.unlockForGet(exclusive)
+
+	if full {
+		mc.tryDrainAccesses()
+	}
+
+	if ok {
+		atomic.AddUint64(&ns.hits, 1)
+	} else {
+		atomic.AddUint64(&ns.misses, 1)
+	}
+
+	return value, ok
+}
+
+// Removes an item from the namespace
+func (ns *Namespace) Remove(key string) {
+	ns.mc.Remove(ns.prefix + key)
+}
+
+// Removes every item in the namespace, leaving other items alone.
+func (ns *Namespace) Purge() {
+	mc := ns.mc
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	for len(ns.queue) > 0 {
+		entry := ns.queue[0]
+		ns.queue = ns.queue[1:]
+
+		if ns.current(entry) {
+			mc.notifyRemoved(entry.item.keys)
+			mc.removeItem(entry.item, RemoveExplicit)
+		}
+	}
+}
+
+// Returns the namespace's statistics.
+func (ns *Namespace) Stats() NamespaceStats {
+	ns.mc.readLock()
+	defer ns.mc.lock.RUnlock()
+
+	return NamespaceStats{
+		Items:          ns.items,
+		Bytes:          ns.bytes,
+		Hits:           atomic.LoadUint64(&ns.hits),
+		Misses:         atomic.LoadUint64(&ns.misses),
+		Evictions:      atomic.LoadUint64(&ns.evictions),
+		QuotaEvictions: atomic.LoadUint64(&ns.quotaEvictions),
+	}
+}
+
+// Replaces the namespace's oldest items until the given number of new items
+// totalling size bytes fit in the quota. Call with the exclusive lock.
+func (ns *Namespace) makeRoom(items int, size int64) {
+	for ns.items > 0 && ns.overQuota(items, size) {
+		entry := ns.queue[0]
+		ns.queue = ns.queue[1:]
+
+		if ns.current(entry) {
+			ns.mc.removeItem(entry.item, RemoveQuota)
+		}
+	}
+}
+
+func (ns *Namespace) overQuota(items int, size int64) bool {
+	if ns.quota.Items > 0 && ns.items+items > ns.quota.Items {
+		return true
+	}
+
+	return ns.quota.Bytes > 0 && ns.bytes+size > ns.quota.Bytes
+}
+
+// True if the entry's item is still in the namespace.
+func (ns *Namespace) current(entry namespaceEntry) bool {
+	return entry.item.namespace == ns && entry.item.generation == entry.generation
+}
+
+// Called by Multicache.removeItem when one of the namespace's items goes.
+func (ns *Namespace) removed(item *MulticacheItem, reason RemoveReason) {
+	ns.items--
+	ns.bytes -= item.size
+
+	switch reason {
+	case RemoveEvicted:
+		atomic.AddUint64(&ns.evictions, 1)
+	case RemoveQuota:
+		atomic.AddUint64(&ns.quotaEvictions, 1)
+	}
+
+	// Drop removed entries once they outnumber the live ones
+	if len(ns.queue) > 2*ns.items+16 {
+		live := ns.queue[:0]
+		for _, entry := range ns.queue {
+			if entry.item != item && ns.current(entry) {
+				live = append(live, entry)
+			}
+		}
+
+		for i := len(live); i < len(ns.queue); i++ {
+			ns.queue[i] = namespaceEntry{}
+		}
+
+		ns.queue = live
+	}
+}
+
+// Forgets every item, called by Multicache.Purge.
+func (ns *Namespace) clear() {
+	ns.queue = nil
+	ns.items = 0
+	ns.bytes = 0
+}
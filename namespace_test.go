@@ -0,0 +1,145 @@
+package multicache
+
+import (
+	"strconv"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func TestNamespacePrefixes(t *testing.T) {
+	mc, _ := NewDefaultMulticache(10)
+	a := mc.Namespace("a")
+	b := mc.Namespace("b")
+	assert(t, mc.Namespace("a") == a, "Namespace not reused")
+
+	a.Add("key", 1)
+	b.AddMany(2, "key", "alias")
+	mc.Add("key", 3)
+
+	value, _ := a.Get("key")
+	assert(t, value == 1, "Wrong value in a")
+	value, _ = b.Get("alias")
+	assert(t, value == 2, "Wrong value in b")
+	value, _ = mc.Get("key")
+	assert(t, value == 3, "Namespace changed a plain key")
+
+	b.Remove("key")
+	_, ok := b.Get("alias")
+	assert(t, !ok, "Alias kept after removal")
+	_, ok = a.Get("key")
+	assert(t, ok, "Removal reached another namespace")
+
+	stats := b.Stats()
+	assert(t, stats.Hits == 1 && stats.Misses == 1 && stats.Items == 0, "Wrong stats")
+}
+
+func TestNamespaceItemQuota(t *testing.T) {
+	mc, _ := NewMulticache(10, &RoundRobin{})
+	quiet := mc.Namespace("quiet")
+	noisy := mc.Namespace("noisy")
+	noisy.SetQuota(Quota{Items: 3})
+
+	for i := 0; i < 4; i++ {
+		quiet.Add(strconv.Itoa(i), i)
+	}
+
+	for i := 0; i < 100; i++ {
+		noisy.Add(strconv.Itoa(i), i)
+	}
+
+	for i := 0; i < 4; i++ {
+		_, ok := quiet.Get(strconv.Itoa(i))
+		assert(t, ok, "Noisy namespace evicted another tenant")
+	}
+
+	// The newest items are kept
+	for i := 97; i < 100; i++ {
+		_, ok := noisy.Get(strconv.Itoa(i))
+		assert(t, ok, "Newest item missing")
+	}
+
+	stats := noisy.Stats()
+	assert(t, stats.Items == 3 && stats.QuotaEvictions == 97, "Wrong quota stats")
+	assert(t, len(noisy.queue) <= 2*stats.Items+16, "Removed items piling up")
+
+	// Overwriting a key at the quota doesn't replace anything else
+	noisy.Add("99", "new")
+	_, ok := noisy.Get("97")
+	assert(t, ok && noisy.Stats().Items == 3, "Overwrite counted against the quota")
+
+	// Lowering the quota applies straight away
+	noisy.SetQuota(Quota{Items: 1})
+	assert(t, noisy.Stats().Items == 1, "Quota not applied")
+}
+
+func TestNamespaceByteQuota(t *testing.T) {
+	mc, _ := NewDefaultMulticache(10)
+	ns := mc.Namespace("ns")
+	ns.SetQuota(Quota{Bytes: 10, Size: func(value interface{}) int64 {
+		return int64(len(value.(string)))
+	}})
+
+	ns.Add("a", "1234")
+	ns.Add("b", "1234")
+	ns.Add("c", "12345")
+
+	_, ok := ns.Get("a")
+	assert(t, !ok, "Over the byte quota")
+	_, ok = ns.Get("b")
+	assert(t, ok, "Item removed while under the quota")
+	assert(t, ns.Stats().Bytes == 9, "Wrong byte count")
+}
+
+func TestPurgeNamespace(t *testing.T) {
+	mc, _ := NewDefaultMulticache(10)
+	a := mc.Namespace("a")
+	b := mc.Namespace("b")
+
+	removed := 0
+	mc.SetRemoveListener(func(keys []string) {
+		removed++
+	})
+
+	for i := 0; i < 3; i++ {
+		a.Add(strconv.Itoa(i), i)
+		b.Add(strconv.Itoa(i), i)
+	}
+
+	mc.PurgeNamespace("a")
+	mc.PurgeNamespace("missing")
+	assert(t, removed == 3 && a.Stats().Items == 0, "Namespace not purged")
+	assert(t, b.Stats().Items == 3 && mc.Len() == 3, "Other namespace purged")
+
+	mc.Purge()
+	assert(t, b.Stats().Items == 0, "Purge not counted")
+}
+
+func TestNamespaceEvictions(t *testing.T) {
+	mc, _ := NewMulticache(2, &RoundRobin{})
+	ns := mc.Namespace("ns")
+
+	ns.Add("a", 1)
+	ns.Add("b", 2)
+	mc.Add("c", 3)
+
+	stats := ns.Stats()
+	assert(t, stats.Items == 1 && stats.Evictions == 1, "Eviction not counted")
+}
+
+func TestNamespaceGetDoesNotAllocate(t *testing.T) {
+	mc, _ := NewDefaultMulticache(10)
+	ns := mc.Namespace("tenant")
+	ns.Add("key", 1)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ns.Get("key")
+	})
+	assert(t, allocs == 0, "Get allocated")
+}
@@ -0,0 +1,214 @@
+package multicache
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+ReplacementAlgorithmV2 versions of the built in algorithms. They keep their
+state in slices indexed by Slot rather than in MulticacheItem.Tag, so they work
+with ByteMulticache as well as NewMulticacheV2.
+**/
+
+/**
+LRUPolicy replaces the least recently used item like LeastRecentlyUsed, and
+like it takes O(n) time to find the victim. Accesses are buffered in a
+Multicache, see AccessBuffering.
+**/
+type LRUPolicy struct {
+	counter int64
+	// The counter when each slot was last used, 0 if it's empty
+	stamps []int64
+}
+
+func (p *LRUPolicy) Reset(slots int) {
+	p.counter = 0
+	p.stamps = make([]int64, slots)
+}
+
+func (p *LRUPolicy) OnInsert(slot Slot, keys []string) {
+	p.OnAccess(slot)
+}
+
+func (p *LRUPolicy) OnRemove(slot Slot, reason RemoveReason) {
+	p.stamps[slot] = 0
+}
+
+func (p *LRUPolicy) OnAccess(slot Slot) bool {
+	p.counter++
+	p.stamps[slot] = p.counter
+	return true
+}
+
+func (p *LRUPolicy) Victim() Slot {
+	victim := 0
+	for slot, stamp := range p.stamps {
+		if stamp < p.stamps[victim] {
+			victim = slot
+		}
+	}
+
+	return Slot(victim)
+}
+
+func (p *LRUPolicy) UpdatesOnAccess() bool {
+	return true
+}
+
+func (p *LRUPolicy) BuffersAccesses() bool {
+	return true
+}
+
+/**
+SecondChancePolicy is SecondChance, sweeping the slots in order and skipping
+those used since the last sweep. The used bits are set atomically so Gets only
+take the read lock.
+**/
+type SecondChancePolicy struct {
+	position int
+	used     []uint32
+}
+
+func (p *SecondChancePolicy) Reset(slots int) {
+	p.position = 0
+	p.used = make([]uint32, slots)
+}
+
+func (p *SecondChancePolicy) OnInsert(slot Slot, keys []string) {}
+
+func (p *SecondChancePolicy) OnRemove(slot Slot, reason RemoveReason) {
+	atomic.StoreUint32(&p.used[slot], 0)
+}
+
+func (p *SecondChancePolicy) OnAccess(slot Slot) bool {
+	if atomic.LoadUint32(&p.used[slot]) == 0 {
+		atomic.StoreUint32(&p.used[slot], 1)
+	}
+
+	return true
+}
+
+func (p *SecondChancePolicy) Victim() Slot {
+	for {
+		p.position = (p.position + 1) % len(p.used)
+
+		if atomic.LoadUint32(&p.used[p.position]) == 0 {
+			return Slot(p.position)
+		}
+
+		atomic.StoreUint32(&p.used[p.position], 0)
+	}
+}
+
+func (p *SecondChancePolicy) UpdatesOnAccess() bool {
+	return false
+}
+
+// RoundRobinPolicy replaces the oldest item first like RoundRobin.
+type RoundRobinPolicy struct {
+	order slotQueue
+}
+
+func (p *RoundRobinPolicy) Reset(slots int) {
+	p.order.reset(slots)
+}
+
+func (p *RoundRobinPolicy) OnInsert(slot Slot, keys []string) {
+	p.order.moveToBack(slot)
+}
+
+func (p *RoundRobinPolicy) OnRemove(slot Slot, reason RemoveReason) {}
+
+func (p *RoundRobinPolicy) OnAccess(slot Slot) bool {
+	return true
+}
+
+func (p *RoundRobinPolicy) Victim() Slot {
+	return p.order.next()
+}
+
+func (p *RoundRobinPolicy) UpdatesOnAccess() bool {
+	return false
+}
+
+// RandomPolicy replaces a random slot like Random.
+type RandomPolicy struct {
+	slots int
+}
+
+func (p *RandomPolicy) Reset(slots int) {
+	p.slots = slots
+}
+
+func (p *RandomPolicy) OnInsert(slot Slot, keys []string) {}
+
+func (p *RandomPolicy) OnRemove(slot Slot, reason RemoveReason) {}
+
+func (p *RandomPolicy) OnAccess(slot Slot) bool {
+	return true
+}
+
+func (p *RandomPolicy) Victim() Slot {
+	return Slot(rand.Intn(p.slots))
+}
+
+func (p *RandomPolicy) UpdatesOnAccess() bool {
+	return false
+}
+
+/**
+TimedExpirePolicy hides items inserted more than Expire ago like TimedExpire.
+If no item has expired the oldest is replaced.
+**/
+type TimedExpirePolicy struct {
+	Expire time.Duration
+
+	// When each slot was filled in nanoseconds since the epoch, 0 if empty
+	inserted []int64
+}
+
+func (p *TimedExpirePolicy) Reset(slots int) {
+	p.inserted = make([]int64, slots)
+}
+
+func (p *TimedExpirePolicy) OnInsert(slot Slot, keys []string) {
+	p.inserted[slot] = time.Now().UnixNano()
+}
+
+func (p *TimedExpirePolicy) OnRemove(slot Slot, reason RemoveReason) {
+	p.inserted[slot] = 0
+}
+
+func (p *TimedExpirePolicy) OnAccess(slot Slot) bool {
+	return time.Now().UnixNano()-p.inserted[slot] <= int64(p.Expire)
+}
+
+func (p *TimedExpirePolicy) Victim() Slot {
+	expired := time.Now().UnixNano() - int64(p.Expire)
+
+	oldest := 0
+	for slot, inserted := range p.inserted {
+		// short circuit the rest of the slots
+		if inserted < expired {
+			return Slot(slot)
+		}
+
+		if inserted < p.inserted[oldest] {
+			oldest = slot
+		}
+	}
+
+	return Slot(oldest)
+}
+
+func (p *TimedExpirePolicy) UpdatesOnAccess() bool {
+	return false
+}
@@ -0,0 +1,75 @@
+package multicache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func TestPoliciesMatchAlgorithms(t *testing.T) {
+	testcases := []struct {
+		name      string
+		algorithm ReplacementAlgorithm
+		policy    ReplacementAlgorithmV2
+	}{
+		{"lru", &LeastRecentlyUsed{}, &LRUPolicy{}},
+		{"second-chance", &SecondChance{}, &SecondChancePolicy{}},
+		{"round-robin", &RoundRobin{}, &RoundRobinPolicy{}},
+	}
+
+	items := randomItems(7, 5000, 40)
+	for _, testcase := range testcases {
+		original, _ := NewMulticache(10, testcase.algorithm)
+		ported, _ := NewMulticacheV2(10, testcase.policy)
+
+		for index, item := range items {
+			_, originalHit := original.Get(item)
+			_, portedHit := ported.Get(item)
+			if originalHit != portedHit {
+				t.Error(testcase.name, "differs from the original at", index)
+				break
+			}
+
+			if !originalHit {
+				original.Add(item, item)
+				ported.Add(item, item)
+			}
+		}
+	}
+}
+
+func TestRandomPolicy(t *testing.T) {
+	mc, _ := NewMulticacheV2(4, &RandomPolicy{})
+	for i := 0; i < 100; i++ {
+		mc.Add(strconv.Itoa(i), i)
+	}
+
+	assert(t, mc.Len() > 0 && mc.Len() <= 4, "Unexpected number of items")
+}
+
+func TestTimedExpirePolicy(t *testing.T) {
+	mc, _ := NewMulticacheV2(2, &TimedExpirePolicy{Expire: 20 * time.Millisecond})
+	mc.Add("a", 1)
+
+	_, ok := mc.Get("a")
+	assert(t, ok, "Item expired early")
+
+	time.Sleep(30 * time.Millisecond)
+	mc.Add("b", 2)
+
+	_, ok = mc.Get("a")
+	assert(t, !ok, "Item didn't expire")
+
+	// a expired so it's replaced before the newer b
+	mc.Add("c", 3)
+	_, ok = mc.Get("b")
+	assert(t, ok, "Unexpired item replaced")
+}
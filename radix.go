@@ -0,0 +1,185 @@
+package multicache
+
+import "strings"
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+/**
+A radix tree of strings, each edge labelled with the bytes it adds so chains
+of single children are merged. Children are kept sorted so walks return keys in
+order.
+**/
+type radixTree struct {
+	root radixNode
+	size int
+}
+
+type radixNode struct {
+	label    string
+	children []*radixNode
+	// True if the path to this node is a key
+	leaf bool
+}
+
+// Adds key to the tree.
+func (t *radixTree) insert(key string) {
+	node := &t.root
+
+	for len(key) > 0 {
+		index, child := node.child(key[0])
+		if child == nil {
+			node.addChild(&radixNode{label: key, leaf: true})
+			t.size++
+			return
+		}
+
+		common := commonPrefixLength(child.label, key)
+		if common < len(child.label) {
+			// Split the edge where key leaves it
+			split := &radixNode{label: child.label[:common], children: []*radixNode{child}}
+			child.label = child.label[common:]
+			node.children[index] = split
+			child = split
+		}
+
+		node = child
+		key = key[common:]
+	}
+
+	if !node.leaf {
+		node.leaf = true
+		t.size++
+	}
+}
+
+// Removes key from the tree if it's there.
+func (t *radixTree) delete(key string) {
+	parent := (*radixNode)(nil)
+	node := &t.root
+
+	for len(key) > 0 {
+		_, child := node.child(key[0])
+		if child == nil || !strings.HasPrefix(key, child.label) {
+			return
+		}
+
+		parent, node = node, child
+		key = key[len(child.label):]
+	}
+
+	if !node.leaf {
+		return
+	}
+
+	node.leaf = false
+	t.size--
+
+	if parent == nil {
+		return
+	}
+
+	if len(node.children) == 0 {
+		parent.removeChild(node)
+		node = parent
+	}
+
+	// Merge a node left with one child into it, except the root
+	if node != &t.root && !node.leaf && len(node.children) == 1 {
+		child := node.children[0]
+		node.label += child.label
+		node.children = child.children
+		node.leaf = child.leaf
+	}
+}
+
+// Calls fn with each key starting with prefix in order until it returns false.
+func (t *radixTree) walkPrefix(prefix string, fn func(key string) bool) {
+	node := &t.root
+	path := ""
+
+	for len(prefix) > 0 {
+		_, child := node.child(prefix[0])
+		if child == nil {
+			return
+		}
+
+		if len(prefix) <= len(child.label) {
+			if !strings.HasPrefix(child.label, prefix) {
+				return
+			}
+		} else if !strings.HasPrefix(prefix, child.label) {
+			return
+		} else {
+			prefix = prefix[len(child.label):]
+			path += child.label
+			node = child
+			continue
+		}
+
+		path += child.label
+		node = child
+		break
+	}
+
+	node.walk(path, fn)
+}
+
+func (n *radixNode) walk(path string, fn func(key string) bool) bool {
+	if n.leaf && !fn(path) {
+		return false
+	}
+
+	for _, child := range n.children {
+		if !child.walk(path+child.label, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Finds the child whose label starts with b.
+func (n *radixNode) child(b byte) (index int, child *radixNode) {
+	for index, child := range n.children {
+		if child.label[0] == b {
+			return index, child
+		}
+	}
+
+	return 0, nil
+}
+
+func (n *radixNode) addChild(child *radixNode) {
+	index := 0
+	for index < len(n.children) && n.children[index].label[0] < child.label[0] {
+		index++
+	}
+
+	n.children = append(n.children, nil)
+	copy(n.children[index+1:], n.children[index:])
+	n.children[index] = child
+}
+
+func (n *radixNode) removeChild(child *radixNode) {
+	for index, c := range n.children {
+		if c == child {
+			n.children = append(n.children[:index], n.children[index+1:]...)
+			return
+		}
+	}
+}
+
+func commonPrefixLength(a, b string) int {
+	length := 0
+	for length < len(a) && length < len(b) && a[length] == b[length] {
+		length++
+	}
+
+	return length
+}
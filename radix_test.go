@@ -0,0 +1,77 @@
+package multicache
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func TestRadixTreeMatchesMap(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+	alphabet := []string{"a", "b", "ab", "/", "org/", "7"}
+
+	tree := &radixTree{}
+	reference := make(map[string]bool)
+
+	for i := 0; i < 5000; i++ {
+		key := ""
+		for length := random.Intn(5); length > 0; length-- {
+			key += alphabet[random.Intn(len(alphabet))]
+		}
+
+		if random.Intn(3) == 0 {
+			tree.delete(key)
+			delete(reference, key)
+		} else {
+			tree.insert(key)
+			reference[key] = true
+		}
+
+		prefix := key
+		if len(prefix) > 0 {
+			prefix = prefix[:random.Intn(len(prefix))]
+		}
+
+		expected := []string{}
+		for k := range reference {
+			if strings.HasPrefix(k, prefix) {
+				expected = append(expected, k)
+			}
+		}
+		sort.Strings(expected)
+
+		found := []string{}
+		tree.walkPrefix(prefix, func(k string) bool {
+			found = append(found, k)
+			return true
+		})
+
+		if !reflect.DeepEqual(found, expected) || tree.size != len(reference) {
+			t.Fatal("Tree differs from the map after", i, "changes, prefix", prefix)
+		}
+	}
+}
+
+func TestRadixTreeMerges(t *testing.T) {
+	tree := &radixTree{}
+	tree.insert("org/7/a")
+	tree.insert("org/7/b")
+	tree.delete("org/7/b")
+
+	// The split edge is joined back up
+	assert(t, len(tree.root.children) == 1 && tree.root.children[0].label == "org/7/a", "Edges not merged")
+
+	tree.delete("org/7/a")
+	tree.delete("missing")
+	assert(t, len(tree.root.children) == 0 && tree.size == 0, "Tree not empty")
+}
@@ -17,6 +17,8 @@ because it does fairly well despite being fast and simple.
 type Random struct {
 }
 
+func (rof *Random) InitItem(item *MulticacheItem) {}
+
 func (rof *Random) Reset(multicache *Multicache) {
 }
 
@@ -0,0 +1,193 @@
+package multicache
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// Limits what Recommend considers, the zero value tries every registered
+// algorithm at every power of two up to the number of distinct keys.
+type RecommendConstraints struct {
+	// The cache sizes to try, if empty the powers of two from MinSize up to
+	// MaxSize are tried along with MaxSize itself.
+	Sizes   []uint64
+	MinSize uint64
+	// Defaults to the number of distinct keys in the trace
+	MaxSize uint64
+
+	// When set, the smallest cache reaching this hit ratio is recommended
+	// rather than the one with the best hit ratio.
+	MinHitRatio float64
+
+	// Defaults to RegisteredAlgorithms
+	Algorithms []NamedAlgorithm
+}
+
+// How one algorithm did at one cache size.
+type Recommendation struct {
+	Algorithm string
+	CacheSize uint64
+
+	HitRatio float64
+	// Bélády's optimal hit ratio at the same size
+	OptimalHitRatio float64
+	// HitRatio as a percentage of OptimalHitRatio
+	PercentOfOptimal float64
+	// Gets and Adds per second made while simulating
+	OpsPerSecond float64
+
+	// Whether HitRatio reached the constraints' MinHitRatio
+	MeetsTarget bool
+}
+
+// Recommendations ranked best first.
+type RecommendReport []Recommendation
+
+/**
+Simulates every algorithm allowed by constraints at each size on the Gets of
+trace and ranks the results.
+
+Without a MinHitRatio the highest hit ratio ranks first, which will usually be
+at the largest size, with smaller and then faster caches breaking ties. With a
+MinHitRatio the results reaching it rank first, smallest cache first, followed
+by the rest by hit ratio.
+**/
+func Recommend(trace TraceReader, constraints RecommendConstraints) (RecommendReport, error) {
+	items, _, err := ReadTraceGets(trace)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithms := constraints.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = RegisteredAlgorithms()
+	}
+
+	report := RecommendReport{}
+	if len(items) == 0 {
+		return report, nil
+	}
+
+	for _, size := range constraints.sizes(items) {
+		optimal := CalculateOptimalHitMiss(items, size)
+
+		for _, algorithm := range algorithms {
+			start := time.Now()
+			ratio := CalculateHitMiss(items, size, algorithm.New())
+			elapsed := time.Since(start)
+
+			result := Recommendation{
+				Algorithm:        algorithm.Name,
+				CacheSize:        size,
+				HitRatio:         ratio,
+				OptimalHitRatio:  optimal,
+				PercentOfOptimal: 100,
+				MeetsTarget:      ratio >= constraints.MinHitRatio,
+			}
+
+			if optimal > 0 {
+				result.PercentOfOptimal = ratio / optimal * 100
+			}
+
+			if elapsed > 0 {
+				result.OpsPerSecond = float64(len(items)) / elapsed.Seconds()
+			}
+
+			report = append(report, result)
+		}
+	}
+
+	sort.SliceStable(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if a.MeetsTarget != b.MeetsTarget {
+			return a.MeetsTarget
+		}
+
+		if constraints.MinHitRatio > 0 && a.MeetsTarget && a.CacheSize != b.CacheSize {
+			return a.CacheSize < b.CacheSize
+		}
+
+		if a.HitRatio != b.HitRatio {
+			return a.HitRatio > b.HitRatio
+		}
+
+		if a.CacheSize != b.CacheSize {
+			return a.CacheSize < b.CacheSize
+		}
+
+		return a.OpsPerSecond > b.OpsPerSecond
+	})
+
+	return report, nil
+}
+
+// The sizes to simulate for items, in increasing order.
+func (constraints RecommendConstraints) sizes(items []string) []uint64 {
+	if len(constraints.Sizes) > 0 {
+		return constraints.Sizes
+	}
+
+	maxSize := constraints.MaxSize
+	if maxSize == 0 {
+		distinct := make(map[string]bool)
+		for _, item := range items {
+			distinct[item] = true
+		}
+
+		maxSize = uint64(len(distinct))
+	}
+
+	sizes := []uint64{}
+	for size := uint64(1); size < maxSize; size *= 2 {
+		if size >= constraints.MinSize {
+			sizes = append(sizes, size)
+		}
+	}
+
+	if maxSize > 0 && maxSize >= constraints.MinSize {
+		sizes = append(sizes, maxSize)
+	}
+
+	return sizes
+}
+
+// Returns the top ranked recommendation, false if nothing was simulated.
+func (r RecommendReport) Best() (Recommendation, bool) {
+	if len(r) == 0 {
+		return Recommendation{}, false
+	}
+
+	return r[0], true
+}
+
+// Writes the report as an aligned table.
+func (r RecommendReport) WriteTable(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "Rank\tAlgorithm\tSize\tHit %\t% of optimal\tOps/sec\t")
+
+	for rank, result := range r {
+		fmt.Fprintf(table, "%d\t%s\t%d\t%.2f\t%.2f\t%.0f\t\n",
+			rank+1, result.Algorithm, result.CacheSize, result.HitRatio*100,
+			result.PercentOfOptimal, result.OpsPerSecond)
+	}
+
+	return table.Flush()
+}
+
+func (r RecommendReport) String() string {
+	var out strings.Builder
+	r.WriteTable(&out)
+	return out.String()
+}
@@ -0,0 +1,73 @@
+package multicache
+
+import (
+	"strings"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+var recommendAlgorithms = []NamedAlgorithm{
+	{"lru", func() ReplacementAlgorithm { return &LeastRecentlyUsed{} }},
+	{"round-robin", func() ReplacementAlgorithm { return &RoundRobin{} }},
+}
+
+func TestRecommend(t *testing.T) {
+	items := randomItems(4, 2000, 100)
+	report, err := Recommend(NewKeyTraceReader(items), RecommendConstraints{
+		Sizes:      []uint64{10, 50},
+		Algorithms: recommendAlgorithms,
+	})
+
+	assert(t, err == nil && len(report) == 4, "Wrong number of results")
+	for _, result := range report {
+		expected := CalculateHitMiss(items, result.CacheSize, recommendAlgorithms[0].New())
+		if result.Algorithm == "round-robin" {
+			expected = CalculateHitMiss(items, result.CacheSize, recommendAlgorithms[1].New())
+		}
+
+		assert(t, result.HitRatio == expected, "Unexpected hit ratio")
+		assert(t, result.OptimalHitRatio == CalculateOptimalHitMiss(items, result.CacheSize), "Unexpected optimal")
+		assert(t, result.PercentOfOptimal > 0 && result.PercentOfOptimal <= 100, "Unexpected percent of optimal")
+	}
+
+	best, ok := report.Best()
+	assert(t, ok && best.CacheSize == 50, "Largest cache should have the best hit ratio")
+	for i := 1; i < len(report); i++ {
+		assert(t, report[i-1].HitRatio >= report[i].HitRatio, "Report not ranked by hit ratio")
+	}
+
+	table := report.String()
+	assert(t, strings.HasPrefix(table, "Rank") && strings.Count(table, "\n") == 5, "Unexpected table: "+table)
+}
+
+func TestRecommendMinHitRatio(t *testing.T) {
+	items := randomItems(5, 2000, 100)
+	small := CalculateHitMiss(items, 16, &LeastRecentlyUsed{})
+
+	report, _ := Recommend(NewKeyTraceReader(items), RecommendConstraints{
+		MaxSize:     100,
+		MinHitRatio: small,
+		Algorithms:  recommendAlgorithms[:1],
+	})
+
+	// 1, 2, 4, ..., 64 and 100
+	assert(t, len(report) == 8, "Unexpected default sizes")
+	best, _ := report.Best()
+	assert(t, best.CacheSize == 16 && best.MeetsTarget, "Smallest cache meeting the target not recommended")
+
+	last := report[len(report)-1]
+	assert(t, !last.MeetsTarget, "Caches missing the target should rank last")
+}
+
+func TestRecommendEmptyTrace(t *testing.T) {
+	report, err := Recommend(NewKeyTraceReader(nil), RecommendConstraints{Sizes: []uint64{4}})
+	_, ok := report.Best()
+	assert(t, err == nil && !ok, "Empty trace produced a recommendation")
+}
@@ -0,0 +1,118 @@
+package multicache
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+/**
+Recorder wraps a live Multicache and writes every Get, Add and Remove made
+through it to a TraceWriter, so real access patterns can be replayed later with
+CalculateHitMissTrace.
+
+Use the Recorder's methods in place of the cache's. Writing a trace never
+stops the cache from working: the first write error is kept and returned by
+Err, and later events are dropped.
+**/
+type Recorder struct {
+	cache  *Multicache
+	writer TraceWriter
+
+	lock sync.Mutex
+	err  error
+}
+
+// Records the operations made on cache to writer.
+func NewRecorder(cache *Multicache, writer TraceWriter) *Recorder {
+	return &Recorder{cache: cache, writer: writer}
+}
+
+// Returns the cache being recorded.
+func (r *Recorder) Cache() *Multicache {
+	return r.cache
+}
+
+// Records and performs Multicache.Get
+func (r *Recorder) Get(key string) (value interface{}, ok bool) {
+	r.record(TraceGet, key)
+	return r.cache.Get(key)
+}
+
+// Records and performs Multicache.Add
+func (r *Recorder) Add(key string, value interface{}) {
+	r.record(TraceAdd, key)
+	r.cache.Add(key, value)
+}
+
+// Records and performs Multicache.AddMany
+func (r *Recorder) AddMany(value interface{}, keys ...string) {
+	r.record(TraceAdd, keys...)
+	r.cache.AddMany(value, keys...)
+}
+
+// Records and performs Multicache.GetOrFind. The lookup is recorded as a Get
+// and, if replaceFunc is called and succeeds, the item it found as an Add.
+func (r *Recorder) GetOrFind(key string, replaceFunc GetOrFindMiss) (item interface{}, err error) {
+	r.record(TraceGet, key)
+
+	return r.cache.GetOrFind(key, func(searchKey string) (interface{}, []string, error) {
+		item, keys, err := replaceFunc(searchKey)
+		if err == nil {
+			r.record(TraceAdd, keys...)
+		}
+
+		return item, keys, err
+	})
+}
+
+// Records and performs Multicache.Remove
+func (r *Recorder) Remove(key string) {
+	r.record(TraceRemove, key)
+	r.cache.Remove(key)
+}
+
+// Flushes the trace and returns the first error encountered while recording.
+func (r *Recorder) Flush() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err == nil {
+		r.err = r.writer.Flush()
+	}
+
+	return r.err
+}
+
+// Returns the first error encountered while recording.
+func (r *Recorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.err
+}
+
+// Events that can't be written to a trace, such as ones with empty keys, are
+// skipped.
+func (r *Recorder) record(op TraceOp, keys ...string) {
+	event := TraceEvent{Time: time.Now(), Op: op, Keys: keys}
+	if !event.valid() {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	r.err = r.writer.Write(event)
+}
@@ -0,0 +1,116 @@
+package multicache
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// Fails every write after the first limit.
+type failingTraceWriter struct {
+	limit  int
+	events []TraceEvent
+}
+
+func (f *failingTraceWriter) Write(event TraceEvent) error {
+	if len(f.events) >= f.limit {
+		return errors.New("disk full")
+	}
+
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *failingTraceWriter) Flush() error {
+	return nil
+}
+
+func TestRecorder(t *testing.T) {
+	mc, _ := NewDefaultMulticache(10)
+	writer := &failingTraceWriter{limit: 100}
+	recorder := NewRecorder(mc, writer)
+
+	recorder.Get("a")
+	recorder.Add("a", 1)
+	recorder.AddMany(2, "b", "c")
+	recorder.Remove("c")
+	recorder.GetOrFind("d", func(key string) (interface{}, []string, error) {
+		return 3, []string{"d", "e"}, nil
+	})
+	recorder.GetOrFind("x", func(key string) (interface{}, []string, error) {
+		return nil, nil, errors.New("not found")
+	})
+
+	expected := []struct {
+		op   TraceOp
+		keys []string
+	}{
+		{TraceGet, []string{"a"}},
+		{TraceAdd, []string{"a"}},
+		{TraceAdd, []string{"b", "c"}},
+		{TraceRemove, []string{"c"}},
+		{TraceGet, []string{"d"}},
+		{TraceAdd, []string{"d", "e"}},
+		{TraceGet, []string{"x"}},
+	}
+
+	assert(t, len(writer.events) == len(expected), "Wrong number of events recorded")
+	for index, event := range writer.events {
+		if index >= len(expected) {
+			break
+		}
+
+		if event.Op != expected[index].op || !reflect.DeepEqual(event.Keys, expected[index].keys) {
+			t.Error("Unexpected event, index:", index, "event:", event)
+		}
+
+		assert(t, !event.Time.IsZero(), "Event without a time")
+	}
+
+	// The operations still reach the cache
+	value, ok := mc.Get("e")
+	assert(t, ok && value == 3, "GetOrFind through the recorder didn't cache")
+	assert(t, recorder.Flush() == nil, "Unexpected recording error")
+}
+
+func TestRecorderErrors(t *testing.T) {
+	mc, _ := NewDefaultMulticache(10)
+	writer := &failingTraceWriter{limit: 1}
+	recorder := NewRecorder(mc, writer)
+
+	recorder.Add("a", 1)
+	recorder.Add("b", 2)
+	recorder.Add("c", 3)
+
+	assert(t, recorder.Err() != nil, "Write error not kept")
+	assert(t, len(writer.events) == 1, "Recording continued after an error")
+
+	_, ok := mc.Get("c")
+	assert(t, ok, "Cache stopped working after a recording error")
+}
+
+func TestRecorderReplay(t *testing.T) {
+	var buffer bytes.Buffer
+	mc, _ := NewMulticache(2, &RoundRobin{})
+	recorder := NewRecorder(mc, NewBinaryTraceWriter(&buffer))
+
+	for _, key := range []string{"3", "3", "3", "2", "1", "1", "2", "3", "1", "1", "3", "2", "1", "3", "1"} {
+		if _, ok := recorder.Get(key); !ok {
+			recorder.Add(key, key)
+		}
+	}
+	recorder.Flush()
+
+	ratio, err := CalculateHitMissReader(&buffer, 2, &RoundRobin{})
+	assert(t, err == nil, "Replay failed")
+	assert(t, ratio == 8.0/15.0, "Replayed trace gave a different ratio")
+}
@@ -0,0 +1,286 @@
+package multicache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+The registry lets ReplacementAlgorithms be created from specs such as "lru" or
+"timed:expire=1s" so configuration files and command line flags can choose
+them. A spec is a registered name optionally followed by a colon and comma
+separated key=value options.
+**/
+
+var (
+	UnknownAlgorithmError = errors.New("Unknown replacement algorithm")
+	InvalidAlgorithmError = errors.New("Invalid replacement algorithm spec")
+)
+
+// The options of an algorithm spec, "timed:expire=1s" has the options
+// {"expire": "1s"}.
+type AlgorithmOptions map[string]string
+
+// An algorithm and the name it's reported under, New is called once per
+// cache.
+type NamedAlgorithm struct {
+	Name string
+	New  AlgorithmFactory
+}
+
+// Creates a ReplacementAlgorithm from the options of a spec.
+type AlgorithmConstructor func(options AlgorithmOptions) (ReplacementAlgorithm, error)
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]AlgorithmConstructor)
+)
+
+func init() {
+	RegisterAlgorithm("lru", withoutOptions(func() ReplacementAlgorithm { return &LeastRecentlyUsed{} }))
+	RegisterAlgorithm("approx-lru", withoutOptions(func() ReplacementAlgorithm { return &ApproximateLRU{} }))
+	RegisterAlgorithm("random", withoutOptions(func() ReplacementAlgorithm { return &Random{} }))
+	RegisterAlgorithm("round-robin", withoutOptions(func() ReplacementAlgorithm { return &RoundRobin{} }))
+	RegisterAlgorithm("second-chance", withoutOptions(func() ReplacementAlgorithm { return &SecondChance{} }))
+	RegisterAlgorithm("sieve", withoutOptions(func() ReplacementAlgorithm { return &Sieve{} }))
+
+	RegisterAlgorithm("timed", func(options AlgorithmOptions) (ReplacementAlgorithm, error) {
+		if err := options.Only("expire"); err != nil {
+			return nil, err
+		}
+
+		expire, err := options.Duration("expire", time.Minute)
+		if err != nil {
+			return nil, err
+		}
+
+		return CreateTimeExpireAlgorithm(expire.Nanoseconds() / int64(time.Millisecond)), nil
+	})
+}
+
+/**
+Makes an algorithm available to NewAlgorithm under name. Third party
+algorithms register themselves from an init function, like database/sql
+drivers do.
+
+Registering a name twice, or a name containing a colon or comma, panics.
+**/
+func RegisterAlgorithm(name string, constructor AlgorithmConstructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if name == "" || strings.ContainsAny(name, ":,") {
+		panic("multicache: invalid algorithm name " + strconv.Quote(name))
+	}
+
+	if _, ok := registry[name]; ok {
+		panic("multicache: algorithm " + strconv.Quote(name) + " registered twice")
+	}
+
+	registry[name] = constructor
+}
+
+// Undoes RegisterAlgorithm, for tests that register their own algorithms.
+func unregisterAlgorithm(name string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	delete(registry, name)
+}
+
+// Creates the algorithm a spec such as "timed:expire=1s" describes.
+func NewAlgorithm(spec string) (ReplacementAlgorithm, error) {
+	name, options, err := parseAlgorithmSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	registryLock.RLock()
+	constructor, ok := registry[name]
+	registryLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w %q", UnknownAlgorithmError, name)
+	}
+
+	algorithm, err := constructor(options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", spec, err)
+	}
+
+	return algorithm, nil
+}
+
+// Creates a multicache holding numItems items using the algorithm spec
+// describes.
+func NewMulticacheFromSpec(numItems uint64, spec string) (*Multicache, error) {
+	algorithm, err := NewAlgorithm(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMulticache(numItems, algorithm)
+}
+
+// Checks spec once and returns a NamedAlgorithm, named by the spec, that
+// creates a fresh algorithm each time.
+func ParseAlgorithm(spec string) (NamedAlgorithm, error) {
+	if _, err := NewAlgorithm(spec); err != nil {
+		return NamedAlgorithm{}, err
+	}
+
+	return NamedAlgorithm{spec, func() ReplacementAlgorithm {
+		algorithm, _ := NewAlgorithm(spec)
+		return algorithm
+	}}, nil
+}
+
+/**
+Parses a comma separated list of specs such as "lru,timed:expire=1s,random".
+Commas also separate options, so an entry holding an = but no colon is taken to
+be another option of the spec before it.
+**/
+func ParseAlgorithmList(specs string) ([]NamedAlgorithm, error) {
+	joined := []string{}
+	for _, part := range strings.Split(specs, ",") {
+		part = strings.TrimSpace(part)
+		isOption := strings.Contains(part, "=") && !strings.Contains(part, ":")
+
+		if isOption && len(joined) > 0 {
+			joined[len(joined)-1] += "," + part
+		} else {
+			joined = append(joined, part)
+		}
+	}
+
+	algorithms := []NamedAlgorithm{}
+	for _, spec := range joined {
+		algorithm, err := ParseAlgorithm(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		algorithms = append(algorithms, algorithm)
+	}
+
+	return algorithms, nil
+}
+
+// Returns the names of the registered algorithms in order.
+func AlgorithmNames() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	names := []string{}
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Returns every registered algorithm with its default options that can be
+// created without any, in name order.
+func RegisteredAlgorithms() []NamedAlgorithm {
+	algorithms := []NamedAlgorithm{}
+	for _, name := range AlgorithmNames() {
+		if algorithm, err := ParseAlgorithm(name); err == nil {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+
+	return algorithms
+}
+
+func parseAlgorithmSpec(spec string) (name string, options AlgorithmOptions, err error) {
+	name, rest, hasOptions := strings.Cut(strings.TrimSpace(spec), ":")
+	options = AlgorithmOptions{}
+
+	if name == "" {
+		return "", nil, fmt.Errorf("%w %q", InvalidAlgorithmError, spec)
+	}
+
+	if !hasOptions {
+		return name, options, nil
+	}
+
+	for _, option := range strings.Split(rest, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(option), "=")
+		if !ok || key == "" {
+			return "", nil, fmt.Errorf("%w %q", InvalidAlgorithmError, spec)
+		}
+
+		options[key] = value
+	}
+
+	return name, options, nil
+}
+
+// Wraps a constructor for an algorithm that takes no options.
+func withoutOptions(create func() ReplacementAlgorithm) AlgorithmConstructor {
+	return func(options AlgorithmOptions) (ReplacementAlgorithm, error) {
+		if err := options.Only(); err != nil {
+			return nil, err
+		}
+
+		return create(), nil
+	}
+}
+
+// Returns an error naming any option not in allowed.
+func (options AlgorithmOptions) Only(allowed ...string) error {
+	for key := range options {
+		found := false
+		for _, name := range allowed {
+			found = found || key == name
+		}
+
+		if !found {
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+
+	return nil
+}
+
+// Returns the option name as a duration like "1s", or def if it isn't set.
+func (options AlgorithmOptions) Duration(name string, def time.Duration) (time.Duration, error) {
+	value, ok := options[name]
+	if !ok {
+		return def, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("option %s: invalid duration %q", name, value)
+	}
+
+	return duration, nil
+}
+
+// Returns the option name as an integer, or def if it isn't set.
+func (options AlgorithmOptions) Int(name string, def int) (int, error) {
+	value, ok := options[name]
+	if !ok {
+		return def, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("option %s: invalid integer %q", name, value)
+	}
+
+	return number, nil
+}
@@ -0,0 +1,84 @@
+package multicache
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func TestNewAlgorithm(t *testing.T) {
+	algorithm, err := NewAlgorithm("lru")
+	_, ok := algorithm.(*LeastRecentlyUsed)
+	assert(t, err == nil && ok, "lru not created")
+
+	algorithm, err = NewAlgorithm("timed:expire=1500ms")
+	timed, ok := algorithm.(*TimedExpire)
+	assert(t, err == nil && ok && timed.timeExpireMs == 1500, "timed options not applied")
+
+	algorithm, _ = NewAlgorithm("timed")
+	assert(t, algorithm.(*TimedExpire).timeExpireMs == 60000, "timed default not applied")
+
+	algorithm, err = NewAlgorithm("sieve")
+	_, ok = algorithm.(*Sieve)
+	assert(t, err == nil && ok, "sieve not created")
+
+	_, err = NewAlgorithm("arc")
+	assert(t, errors.Is(err, UnknownAlgorithmError), "Unknown algorithm accepted")
+
+	for _, invalid := range []string{"", ":expire=1s", "timed:expire", "timed:expire=soon", "timed:ttl=1s", "lru:size=2"} {
+		_, err := NewAlgorithm(invalid)
+		assert(t, err != nil, "Invalid spec accepted: "+invalid)
+	}
+}
+
+func TestRegisterAlgorithm(t *testing.T) {
+	RegisterAlgorithm("test-fifo", func(options AlgorithmOptions) (ReplacementAlgorithm, error) {
+		if err := options.Only("start"); err != nil {
+			return nil, err
+		}
+
+		_, err := options.Int("start", 0)
+		return &RoundRobin{}, err
+	})
+	t.Cleanup(func() { unregisterAlgorithm("test-fifo") })
+
+	mc, err := NewMulticacheFromSpec(2, "test-fifo:start=1")
+	assert(t, err == nil && mc.replace.(*RoundRobin) != nil, "Registered algorithm not created")
+	assert(t, strings.Contains(strings.Join(AlgorithmNames(), " "), "test-fifo"), "Registered algorithm not listed")
+
+	_, err = NewAlgorithm("test-fifo:start=x")
+	assert(t, err != nil, "Invalid option accepted")
+
+	defer func() {
+		assert(t, recover() != nil, "Registering twice didn't panic")
+	}()
+	RegisterAlgorithm("test-fifo", nil)
+}
+
+func TestParseAlgorithmList(t *testing.T) {
+	algorithms, err := ParseAlgorithmList("lru, timed:expire=1s,random")
+	assert(t, err == nil && len(algorithms) == 3, "List not parsed")
+
+	names := []string{}
+	for _, algorithm := range algorithms {
+		names = append(names, algorithm.Name)
+	}
+	assert(t, algorithms[0].New() != algorithms[0].New(), "Factories must create fresh algorithms")
+	assert(t, reflect.DeepEqual(names, []string{"lru", "timed:expire=1s", "random"}), "Unexpected names")
+
+	_, err = ParseAlgorithmList("lru,nope")
+	assert(t, err != nil, "Unknown algorithm accepted")
+
+	for _, algorithm := range RegisteredAlgorithms() {
+		assert(t, algorithm.New() != nil, "Registered algorithm "+algorithm.Name+" can't be created")
+	}
+}
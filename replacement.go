@@ -37,3 +37,57 @@ type ReplacementAlgorithm interface {
 	// returned to the caller instead, for example in a time based cache.
 	ItemRetrieved(item *MulticacheItem) bool
 }
+
+/** ConcurrentRetriever is implemented by ReplacementAlgorithms whose
+ItemRetrieved only touches shared state through sync/atomic, so it is safe to
+call from many goroutines at once. When RetrievesConcurrently returns true the
+Multicache calls ItemRetrieved with only the read lock held even if
+UpdatesOnRetrieved is true, letting Gets run in parallel.
+
+The other functions are still called with the exclusive lock held, but Tags
+read there may have been stored atomically by ItemRetrieved so they should be
+read with atomic.LoadInt64 too.
+**/
+type ConcurrentRetriever interface {
+	RetrievesConcurrently() bool
+}
+
+// Whether ItemRetrieved marks items rather than moving them, see ReferenceMarker.
+func marksReferences(algorithm ReplacementAlgorithm) bool {
+	marker, ok := algorithm.(ReferenceMarker)
+	return ok && marker.MarksReferences()
+}
+
+// Whether Get has to take the exclusive lock for the algorithm.
+func retrieveNeedsWriteLock(algorithm ReplacementAlgorithm) bool {
+	if concurrent, ok := algorithm.(ConcurrentRetriever); ok && concurrent.RetrievesConcurrently() {
+		return false
+	}
+
+	return algorithm.UpdatesOnRetrieved()
+}
+
+/** BufferedRetriever is implemented by ReplacementAlgorithms that need the
+exclusive lock in ItemRetrieved but don't mind being told about Gets late.
+When BuffersRetrievals returns true, Gets take the read lock and record the
+item in a buffer, and ItemRetrieved is called for the recorded items under the
+exclusive lock before the next Add or when a buffer fills.
+
+Under heavy concurrent use some recorded Gets are dropped. Because the item is
+returned before ItemRetrieved is called, its result is ignored, so algorithms
+that use it to expire items shouldn't buffer.
+**/
+type BufferedRetriever interface {
+	BuffersRetrievals() bool
+}
+
+/** ReferenceMarker is implemented by ReplacementAlgorithms whose ItemRetrieved
+marks an item as referenced, like the bit SecondChance keeps, rather than
+moving it to the most recently used end. Items put in a slot freed by a
+removal are normally passed to ItemRetrieved so they don't look like the
+oldest item, but when MarksReferences returns true they only go through
+InitItem and start unreferenced like any other new item.
+**/
+type ReferenceMarker interface {
+	MarksReferences() bool
+}
@@ -0,0 +1,155 @@
+package multicache
+
+import "strconv"
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// Identifies one of the cache's item slots, from 0 to Capacity()-1.
+type Slot int
+
+// Why an item left its slot.
+type RemoveReason int
+
+const (
+	// Remove or RemoveManyFunc removed the item
+	RemoveExplicit RemoveReason = iota
+	// Victim chose the item's slot for a new item
+	RemoveEvicted
+	// A new item was added with one of the item's keys
+	RemoveOverwritten
+	// The item's Namespace was over its quota
+	RemoveQuota
+)
+
+func (reason RemoveReason) String() string {
+	switch reason {
+	case RemoveExplicit:
+		return "explicit"
+	case RemoveEvicted:
+		return "evicted"
+	case RemoveOverwritten:
+		return "overwritten"
+	case RemoveQuota:
+		return "quota"
+	}
+
+	return "reason(" + strconv.Itoa(int(reason)) + ")"
+}
+
+/** ReplacementAlgorithmV2 is told about every change to the cache's slots,
+including the keys of each item and why items leave, so algorithms can keep
+their own indices, queues or ghost entries rather than relying on
+MulticacheItem.Tag. Use it with NewMulticacheV2.
+
+As with ReplacementAlgorithm, the methods are called with the cache locked so
+they must not call any functions of the Multicache.
+**/
+type ReplacementAlgorithmV2 interface {
+	// Called with the number of slots when the cache is created and each time
+	// it's purged, every slot is empty afterwards.
+	Reset(slots int)
+	// An item with the given keys was stored in slot. The keys must not be
+	// modified.
+	OnInsert(slot Slot, keys []string)
+	// The item in slot was removed, it isn't called for empty slots.
+	OnRemove(slot Slot, reason RemoveReason)
+	// Get found the item in slot. Returning false hides the item from the
+	// caller, for example because it expired.
+	OnAccess(slot Slot) bool
+	// Returns the slot the next item is stored in. If the slot holds an item
+	// it's evicted first and OnRemove is called. Slots emptied by OnRemove
+	// are filled before Victim is asked again, so it's only called while the
+	// cache is filling up or full.
+	Victim() Slot
+	// True if OnAccess changes the algorithm's state, Get then takes the
+	// exclusive lock rather than the read lock. Returning false promises
+	// OnAccess is safe to call from many goroutines at once, for example
+	// because it only uses sync/atomic.
+	UpdatesOnAccess() bool
+}
+
+/**
+AccessBuffering is the ReplacementAlgorithmV2 version of BufferedRetriever.
+When BuffersAccesses and UpdatesOnAccess both return true, Gets take the read
+lock and OnAccess is called later under the exclusive lock, and its result is
+ignored.
+**/
+type AccessBuffering interface {
+	BuffersAccesses() bool
+}
+
+/**
+KeyTracking is implemented by ReplacementAlgorithmV2s that keep their own
+index of items by key. AddAlias and UnlinkKey change the keys of an item
+without it leaving its slot, OnKeysChanged is then called with every key the
+item in slot now has. The keys must not be modified.
+**/
+type KeyTracking interface {
+	OnKeysChanged(slot Slot, keys []string)
+}
+
+/**
+Lets the original ReplacementAlgorithm interface drive a Multicache, which
+only talks to ReplacementAlgorithmV2. Every call maps onto the one the cache
+made before the second interface existed, so algorithms behave exactly as they
+always have.
+**/
+type algorithmAdapter struct {
+	algorithm ReplacementAlgorithm
+	mc        *Multicache
+
+	// The slot Victim last returned, so OnInsert can tell whether the
+	// algorithm chose the slot or it came from the cache's free list.
+	victim      Slot
+	choseVictim bool
+}
+
+func (a *algorithmAdapter) Reset(slots int) {
+	a.choseVictim = false
+	a.algorithm.Reset(a.mc)
+}
+
+/**
+The original interface expects GetNextReplacement to choose every slot, some
+algorithms such as LeastRecentlyUsed update the chosen item there. Items put
+in a free slot instead are treated as just used so they aren't left looking
+like the item that was removed, unless the algorithm is a ReferenceMarker.
+**/
+func (a *algorithmAdapter) OnInsert(slot Slot, keys []string) {
+	item := a.mc.itemList[slot]
+	a.algorithm.InitItem(item)
+
+	if (!a.choseVictim || a.victim != slot) && !marksReferences(a.algorithm) {
+		a.algorithm.ItemRetrieved(item)
+	}
+
+	a.choseVictim = false
+}
+
+// The original interface isn't told about removals.
+func (a *algorithmAdapter) OnRemove(slot Slot, reason RemoveReason) {}
+
+func (a *algorithmAdapter) OnAccess(slot Slot) bool {
+	return a.algorithm.ItemRetrieved(a.mc.itemList[slot])
+}
+
+func (a *algorithmAdapter) Victim() Slot {
+	a.victim = a.algorithm.GetNextReplacement(a.mc).slot
+	a.choseVictim = true
+	return a.victim
+}
+
+func (a *algorithmAdapter) UpdatesOnAccess() bool {
+	return retrieveNeedsWriteLock(a.algorithm)
+}
+
+func (a *algorithmAdapter) BuffersAccesses() bool {
+	buffered, ok := a.algorithm.(BufferedRetriever)
+	return ok && buffered.BuffersRetrievals()
+}
@@ -0,0 +1,116 @@
+package multicache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// A first in first out ReplacementAlgorithmV2 that logs every call.
+type recordingPolicy struct {
+	events []string
+	queue  []Slot
+	hidden map[Slot]bool
+}
+
+func (r *recordingPolicy) Reset(slots int) {
+	r.events = append(r.events, fmt.Sprint("reset ", slots))
+	r.queue = nil
+	for slot := 0; slot < slots; slot++ {
+		r.queue = append(r.queue, Slot(slot))
+	}
+}
+
+func (r *recordingPolicy) OnInsert(slot Slot, keys []string) {
+	r.events = append(r.events, fmt.Sprint("insert ", slot, " ", strings.Join(keys, ",")))
+	r.queue = append(r.queue, slot)
+}
+
+func (r *recordingPolicy) OnRemove(slot Slot, reason RemoveReason) {
+	r.events = append(r.events, fmt.Sprint("remove ", slot, " ", reason))
+
+	// The cache reuses emptied slots itself
+	if reason != RemoveEvicted {
+		for i, queued := range r.queue {
+			if queued == slot {
+				r.queue = append(r.queue[:i], r.queue[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (r *recordingPolicy) OnKeysChanged(slot Slot, keys []string) {
+	r.events = append(r.events, fmt.Sprint("keys ", slot, " ", strings.Join(keys, ",")))
+}
+
+func (r *recordingPolicy) OnAccess(slot Slot) bool {
+	r.events = append(r.events, fmt.Sprint("access ", slot))
+	return !r.hidden[slot]
+}
+
+func (r *recordingPolicy) Victim() Slot {
+	slot := r.queue[0]
+	r.queue = r.queue[1:]
+	return slot
+}
+
+func (r *recordingPolicy) UpdatesOnAccess() bool {
+	return true
+}
+
+func TestReplacementAlgorithmV2(t *testing.T) {
+	policy := &recordingPolicy{hidden: make(map[Slot]bool)}
+	mc, err := NewMulticacheV2(2, policy)
+	assert(t, err == nil && mc.replace == nil, "Cache not created")
+
+	mc.Add("a", 1)
+	mc.AddMany(2, "b", "c")
+	mc.Get("a")
+	mc.AddMany(3, "c", "d")
+	mc.Remove("a")
+	mc.Add("e", 4)
+	mc.Add("f", 5)
+	mc.Purge()
+
+	expected := []string{
+		"reset 2",
+		"insert 0 a",
+		"insert 1 b,c",
+		"access 0",
+		// Slot 0 is evicted before c's old item is found to be overwritten
+		"remove 0 evicted",
+		"remove 1 overwritten",
+		"insert 0 c,d",
+		// Slot 1 was emptied so it's reused without asking for a victim
+		"insert 1 e",
+		"remove 0 evicted",
+		"insert 0 f",
+		"reset 2",
+	}
+	assert(t, reflect.DeepEqual(policy.events, expected), fmt.Sprint("Unexpected events: ", policy.events))
+
+	// Items the algorithm hides aren't returned
+	mc.Add("g", 6)
+	policy.hidden[0] = true
+	_, ok := mc.Get("g")
+	assert(t, !ok, "Hidden item returned")
+
+	_, err = NewMulticacheV2(0, policy)
+	assert(t, err == InvalidSizeError, "Empty cache created")
+}
+
+func TestRemoveReasonString(t *testing.T) {
+	assert(t, RemoveExplicit.String() == "explicit", "Wrong name")
+	assert(t, RemoveQuota.String() == "quota", "Wrong name")
+	assert(t, RemoveReason(42).String() == "reason(42)", "Wrong name for unknown reason")
+}
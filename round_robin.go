@@ -14,18 +14,20 @@ Replaces the oldest item in the cache first, then the next oldest, etc.
 This is an extremely simple (and thus fast) replacement strategy.
 **/
 type RoundRobin struct {
-	position uint64
+	order slotQueue
 }
 
-func (rof *RoundRobin) InitItem(item *MulticacheItem) {}
+func (rof *RoundRobin) InitItem(item *MulticacheItem) {
+	// Items put in a slot freed by a removal are the newest too
+	rof.order.moveToBack(item.slot)
+}
 
 func (rof *RoundRobin) Reset(multicache *Multicache) {
-	rof.position = 0
+	rof.order.reset(len(multicache.itemList))
 }
 
 func (rof *RoundRobin) GetNextReplacement(multicache *Multicache) *MulticacheItem {
-	rof.position = uint64(rof.position+1) % multicache.cacheSize
-	return multicache.itemList[rof.position]
+	return multicache.itemList[rof.order.next()]
 }
 
 func (rof *RoundRobin) UpdatesOnRetrieved() bool {
@@ -36,3 +38,52 @@ func (rof *RoundRobin) ItemRetrieved(item *MulticacheItem) bool {
 	// We don't update anything here, no need.
 	return true
 }
+
+/**
+The cache's slots from the oldest item to the newest, as a circular doubly
+linked list so a slot refilled out of turn can move to the back in O(1).
+Slots start in the order 1, 2, ..., 0.
+**/
+type slotQueue struct {
+	head       Slot
+	prev, succ []Slot
+}
+
+func (q *slotQueue) reset(slots int) {
+	q.prev = make([]Slot, slots)
+	q.succ = make([]Slot, slots)
+
+	for i := range q.succ {
+		q.succ[i] = Slot((i + 1) % slots)
+		q.prev[(i+1)%slots] = Slot(i)
+	}
+
+	q.head = q.succ[0]
+}
+
+// Returns the oldest slot and moves it to the back for the item going in it.
+func (q *slotQueue) next() Slot {
+	slot := q.head
+	q.head = q.succ[slot]
+	return slot
+}
+
+// Makes slot the newest.
+func (q *slotQueue) moveToBack(slot Slot) {
+	switch slot {
+	case q.head:
+		q.head = q.succ[slot]
+		return
+	case q.prev[q.head]:
+		return
+	}
+
+	q.succ[q.prev[slot]] = q.succ[slot]
+	q.prev[q.succ[slot]] = q.prev[slot]
+
+	tail := q.prev[q.head]
+	q.succ[tail] = slot
+	q.prev[slot] = tail
+	q.succ[slot] = q.head
+	q.prev[q.head] = slot
+}
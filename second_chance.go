@@ -1,5 +1,7 @@
 package multicache
 
+import "sync/atomic"
+
 /**
 This file is part of multicache, a library for handling caches with multiple
 keys and replacement algorithms.
@@ -18,12 +20,18 @@ accessed bit is set then the item is passed over and the accessed bit is
 removed giving the item a "second chance". This algorithm has all the efficiency
 of round robin but has some properties of LRU without needing O(N) time per
 access.
+
+The accessed bit is set atomically so Gets only take the read lock, see
+ConcurrentRetriever.
 **/
 type SecondChance struct {
 	position uint64
 }
 
-func (rof *SecondChance) InitItem(item *MulticacheItem) {}
+func (rof *SecondChance) InitItem(item *MulticacheItem) {
+	// A slot freed by a removal may still have the old item's bit set
+	atomic.StoreInt64(&item.Tag, 0)
+}
 
 func (rof *SecondChance) Reset(multicache *Multicache) {
 	rof.position = 0
@@ -37,12 +45,12 @@ func (rof *SecondChance) GetNextReplacement(multicache *Multicache) *MulticacheI
 		currentItem := multicache.itemList[rof.position]
 
 		// This item hasn't been referenced since the last sweep
-		if currentItem.Tag == 0 {
+		if atomic.LoadInt64(&currentItem.Tag) == 0 {
 			return currentItem
 		}
 
 		// Mark this for being swept next time.
-		currentItem.Tag = 0
+		atomic.StoreInt64(&currentItem.Tag, 0)
 	}
 }
 
@@ -51,7 +59,19 @@ func (rof *SecondChance) UpdatesOnRetrieved() bool {
 }
 
 func (rof *SecondChance) ItemRetrieved(item *MulticacheItem) bool {
-	// Set a flag representing the item being referenced.
-	item.Tag = 1
+	// Set a flag representing the item being referenced, skipping the store
+	// if it's already set so hot items don't bounce between processors.
+	if atomic.LoadInt64(&item.Tag) == 0 {
+		atomic.StoreInt64(&item.Tag, 1)
+	}
+
+	return true
+}
+
+func (rof *SecondChance) RetrievesConcurrently() bool {
+	return true
+}
+
+func (rof *SecondChance) MarksReferences() bool {
 	return true
 }
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+const (
+	// Items are addressed as CachePath + key
+	CachePath = "/cache/"
+	// Counters and cache occupancy are reported as JSON here
+	StatsPath = "/stats"
+)
+
+/**
+HTTPHandler exposes a Multicache over HTTP. Values are stored as the raw
+request body and returned byte for byte.
+
+	GET    /cache/{key}                 fetch a value, 404 on a miss
+	PUT    /cache/{key}?key=k2&key=k3   store the body under every given key
+	DELETE /cache/{key}                 remove the item and all of its keys
+	GET    /stats                       counters as JSON
+
+A PUT with extra keys behaves like AddMany: deleting any one of the keys
+removes the item for all of them.
+
+Passing ttl=<duration> to PUT, e.g. ttl=90s, makes the item expire.
+
+A PUT body longer than MaxValueSize is rejected with 413 Request Entity Too
+Large.
+**/
+type HTTPHandler struct {
+	// Largest body a PUT may send, DefaultMaxValueSize unless changed
+	MaxValueSize int64
+
+	store *Store
+}
+
+// The JSON document served at StatsPath
+type httpStats struct {
+	Stats
+	Capacity uint64 `json:"capacity"`
+	Items    int    `json:"items"`
+}
+
+// Creates a handler serving the given store.
+func NewHTTPHandler(store *Store) *HTTPHandler {
+	return &HTTPHandler{MaxValueSize: DefaultMaxValueSize, store: store}
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == StatsPath {
+		h.serveStats(w, r)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, CachePath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, CachePath)
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET", "HEAD":
+		h.serveGet(w, key)
+	case "PUT":
+		h.servePut(w, r, key)
+	case "DELETE":
+		h.store.remove(key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *HTTPHandler) serveGet(w http.ResponseWriter, key string) {
+	e, ok := h.store.get(key)
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(e.value)
+}
+
+func (h *HTTPHandler) servePut(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, h.MaxValueSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var expires time.Time
+	if ttl := query.Get("ttl"); ttl != "" {
+		duration, err := time.ParseDuration(ttl)
+		if err != nil {
+			http.Error(w, "bad ttl: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		expires = time.Now().Add(duration)
+	}
+
+	h.store.set(body, 0, expires, append([]string{key}, query["key"]...)...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPHandler) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cache := h.store.Cache()
+	stats := httpStats{h.store.Stats(), cache.Capacity(), cache.Len()}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func assert(t *testing.T, assertion bool, errinfo string) {
+	if !assertion {
+		t.Error(errinfo)
+	}
+}
+
+func newTestHTTPServer(t *testing.T) *httptest.Server {
+	mc, _ := multicache.NewDefaultMulticache(10)
+	return httptest.NewServer(NewHTTPHandler(NewStore(mc)))
+}
+
+func doRequest(t *testing.T, method, url string, body []byte) (int, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, respBody
+}
+
+func TestHTTPGetPutDelete(t *testing.T) {
+	ts := newTestHTTPServer(t)
+	defer ts.Close()
+
+	code, _ := doRequest(t, "GET", ts.URL+"/cache/foo", nil)
+	assert(t, code == http.StatusNotFound, "Got non existant item")
+
+	code, _ = doRequest(t, "PUT", ts.URL+"/cache/foo", []byte("bar"))
+	assert(t, code == http.StatusNoContent, "PUT failed")
+
+	code, body := doRequest(t, "GET", ts.URL+"/cache/foo", nil)
+	assert(t, code == http.StatusOK, "Didn't get inserted value")
+	assert(t, string(body) == "bar", "Returned value was incorrect")
+
+	code, _ = doRequest(t, "DELETE", ts.URL+"/cache/foo", nil)
+	assert(t, code == http.StatusNoContent, "DELETE failed")
+
+	code, _ = doRequest(t, "GET", ts.URL+"/cache/foo", nil)
+	assert(t, code == http.StatusNotFound, "Got removed value")
+}
+
+func TestHTTPPutMany(t *testing.T) {
+	ts := newTestHTTPServer(t)
+	defer ts.Close()
+
+	doRequest(t, "PUT", ts.URL+"/cache/a?key=b&key=c&key=a", []byte("shared"))
+
+	for _, key := range []string{"a", "b", "c"} {
+		code, body := doRequest(t, "GET", ts.URL+"/cache/"+key, nil)
+		assert(t, code == http.StatusOK, "Missing multikey "+key)
+		assert(t, string(body) == "shared", "Wrong value for multikey "+key)
+	}
+
+	// Deleting one key gets rid of all of them
+	doRequest(t, "DELETE", ts.URL+"/cache/b", nil)
+	code, _ := doRequest(t, "GET", ts.URL+"/cache/a", nil)
+	assert(t, code == http.StatusNotFound, "Didn't remove all multikey references")
+}
+
+func TestHTTPBadRequests(t *testing.T) {
+	ts := newTestHTTPServer(t)
+	defer ts.Close()
+
+	code, _ := doRequest(t, "GET", ts.URL+"/cache/", nil)
+	assert(t, code == http.StatusBadRequest, "Empty key accepted")
+
+	code, _ = doRequest(t, "POST", ts.URL+"/cache/foo", nil)
+	assert(t, code == http.StatusMethodNotAllowed, "POST accepted")
+
+	code, _ = doRequest(t, "PUT", ts.URL+"/cache/foo?ttl=soon", nil)
+	assert(t, code == http.StatusBadRequest, "Bad ttl accepted")
+
+	code, _ = doRequest(t, "GET", ts.URL+"/nothing", nil)
+	assert(t, code == http.StatusNotFound, "Unknown path served")
+}
+
+func TestHTTPStats(t *testing.T) {
+	ts := newTestHTTPServer(t)
+	defer ts.Close()
+
+	doRequest(t, "PUT", ts.URL+"/cache/foo?key=bar", []byte("1"))
+	doRequest(t, "GET", ts.URL+"/cache/foo", nil)
+	doRequest(t, "GET", ts.URL+"/cache/baz", nil)
+	doRequest(t, "DELETE", ts.URL+"/cache/baz", nil)
+
+	code, body := doRequest(t, "GET", ts.URL+"/stats", nil)
+	assert(t, code == http.StatusOK, "Stats failed")
+
+	var stats httpStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	assert(t, stats.Gets == 2, "Wrong get count")
+	assert(t, stats.Hits == 1, "Wrong hit count")
+	assert(t, stats.Misses == 1, "Wrong miss count")
+	assert(t, stats.Sets == 1, "Wrong set count")
+	assert(t, stats.Deletes == 1, "Wrong delete count")
+	assert(t, stats.Capacity == 10, "Wrong capacity")
+	assert(t, stats.Items == 1, "Wrong item count")
+}
+
+func TestHTTPTTL(t *testing.T) {
+	ts := newTestHTTPServer(t)
+	defer ts.Close()
+
+	doRequest(t, "PUT", ts.URL+"/cache/short?ttl=1ms", []byte("1"))
+	doRequest(t, "PUT", ts.URL+"/cache/long?ttl=1h", []byte("2"))
+	time.Sleep(5 * time.Millisecond)
+
+	code, _ := doRequest(t, "GET", ts.URL+"/cache/short", nil)
+	assert(t, code == http.StatusNotFound, "Got expired value")
+
+	code, _ = doRequest(t, "GET", ts.URL+"/cache/long", nil)
+	assert(t, code == http.StatusOK, "Didn't get unexpired value")
+}
+
+func TestHTTPValueTooLarge(t *testing.T) {
+	mc, _ := multicache.NewDefaultMulticache(10)
+	handler := NewHTTPHandler(NewStore(mc))
+	handler.MaxValueSize = 4
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	code, _ := doRequest(t, "PUT", ts.URL+"/cache/big", []byte("12345"))
+	assert(t, code == http.StatusRequestEntityTooLarge, "Oversized value accepted")
+
+	code, _ = doRequest(t, "GET", ts.URL+"/cache/big", nil)
+	assert(t, code == http.StatusNotFound, "Oversized value stored")
+
+	code, _ = doRequest(t, "PUT", ts.URL+"/cache/small", []byte("1234"))
+	assert(t, code == http.StatusNoContent, "Value at the limit rejected")
+}
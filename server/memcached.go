@@ -0,0 +1,445 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+const (
+	// Longest key the memcached protocol allows
+	memcachedMaxKeyLength = 250
+	// exptime values above this are absolute unix times rather than offsets
+	memcachedMaxRelativeExptime = 60 * 60 * 24 * 30
+	// Largest value that can be stored, memcached's default
+	memcachedMaxItemSize = 1024 * 1024
+	// Longest command line, the connection is closed after a longer one
+	memcachedMaxLineLength = 64 * 1024
+
+	// Reported by the version and stats commands
+	Version = "multicache-1.0"
+)
+
+var (
+	memcachedLineTooLong = errors.New("Line too long")
+)
+
+/**
+MemcachedServer speaks the memcached ASCII protocol on top of a Store, so
+existing memcached clients can use a Multicache.
+
+Supported commands are get, gets, set, add, replace, cas, delete, touch,
+flush_all, stats, version and quit. exptime becomes the expiry of the stored
+item and flush_all purges the cache. Values over 1MB are refused, memcached's
+default limit.
+
+The extension command
+
+	alias <key> <newkey>+ [noreply]
+
+makes the item stored under key reachable through every newkey as well, in
+the same way AddMany stores one value under several keys. It replies STORED,
+or NOT_FOUND if there is no item under key. Deleting any of the keys
+afterwards removes the item for all of them.
+**/
+type MemcachedServer struct {
+	store   *Store
+	started time.Time
+}
+
+// Creates a memcached front end for the given store.
+func NewMemcachedServer(store *Store) *MemcachedServer {
+	return &MemcachedServer{store: store, started: time.Now()}
+}
+
+// Listens on the TCP network address addr and serves connections.
+func (ms *MemcachedServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return ms.Serve(l)
+}
+
+// Serves each connection accepted on l in its own goroutine. Serve returns
+// when l returns an error, e.g. because it was closed.
+func (ms *MemcachedServer) Serve(l net.Listener) error {
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go ms.ServeConn(conn)
+	}
+}
+
+// Handles commands on conn until the client quits or disconnects.
+func (ms *MemcachedServer) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		line, err := readMemcachedLine(reader)
+		if err == memcachedLineTooLong {
+			clientError(writer, "line too long")
+			writer.Flush()
+			return
+		} else if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			writer.WriteString("ERROR\r\n")
+		} else if fields[0] == "quit" {
+			writer.Flush()
+			return
+		} else if err := ms.dispatch(fields, reader, writer); err != nil {
+			writer.Flush()
+			return
+		}
+
+		// Only flush once the client has stopped pipelining commands.
+		if reader.Buffered() == 0 {
+			if writer.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// Runs a single command. Errors are only returned if the connection should
+// be closed.
+func (ms *MemcachedServer) dispatch(fields []string, r *bufio.Reader, w *bufio.Writer) error {
+	command, args := fields[0], fields[1:]
+
+	switch command {
+	case "get":
+		return ms.get(args, w, false)
+	case "gets":
+		return ms.get(args, w, true)
+	case "set", "add", "replace", "cas":
+		return ms.storage(command, args, r, w)
+	case "delete":
+		return ms.delete(args, w)
+	case "touch":
+		return ms.touch(args, w)
+	case "alias":
+		return ms.alias(args, w)
+	case "flush_all":
+		return ms.flushAll(args, w)
+	case "stats":
+		return ms.stats(w)
+	case "version":
+		_, err := fmt.Fprintf(w, "VERSION %s\r\n", Version)
+		return err
+	}
+
+	_, err := w.WriteString("ERROR\r\n")
+	return err
+}
+
+func (ms *MemcachedServer) get(keys []string, w *bufio.Writer, withCas bool) error {
+	if len(keys) == 0 {
+		return clientError(w, "no keys given")
+	}
+
+	for _, key := range keys {
+		e, ok := ms.store.get(key)
+		if !ok {
+			continue
+		}
+
+		if withCas {
+			fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, e.flags, len(e.value), e.cas)
+		} else {
+			fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, e.flags, len(e.value))
+		}
+
+		w.Write(e.value)
+		w.WriteString("\r\n")
+	}
+
+	_, err := w.WriteString("END\r\n")
+	return err
+}
+
+// Handles set, add, replace and cas which all have the form
+// <command> <key> <flags> <exptime> <bytes> [cas unique] [noreply]
+// followed by a data block.
+func (ms *MemcachedServer) storage(command string, args []string, r *bufio.Reader, w *bufio.Writer) error {
+	required := 4
+	if command == "cas" {
+		required = 5
+	}
+
+	if len(args) < required || len(args) > required+1 {
+		return clientError(w, "bad command line format")
+	}
+
+	key := args[0]
+	flags, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, exptimeErr := strconv.ParseInt(args[2], 10, 64)
+	length, lengthErr := strconv.ParseUint(args[3], 10, 31)
+	if flagsErr != nil || exptimeErr != nil || lengthErr != nil {
+		return clientError(w, "bad command line format")
+	}
+
+	var cas uint64
+	if command == "cas" {
+		var err error
+		if cas, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			return clientError(w, "bad command line format")
+		}
+	}
+
+	noreply := len(args) == required+1 && args[required] == "noreply"
+
+	// Skip the data block of items too large to store without reading it
+	// into memory.
+	if length > memcachedMaxItemSize {
+		if _, err := io.CopyN(io.Discard, r, int64(length)+2); err != nil {
+			return err
+		}
+
+		_, err := w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return err
+	}
+
+	// The data block must be consumed even if the key is bad so the
+	// connection stays in sync.
+	data := make([]byte, length+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+
+	if string(data[length:]) != "\r\n" {
+		return clientError(w, "bad data chunk")
+	}
+
+	if !validKey(key) {
+		return clientError(w, "bad key")
+	}
+
+	value := data[:length:length]
+	expires := memcachedExpiry(exptime)
+
+	stored := true
+	response := "STORED"
+	switch command {
+	case "set":
+		ms.store.set(value, uint32(flags), expires, key)
+	case "add":
+		stored = ms.store.add(key, value, uint32(flags), expires)
+	case "replace":
+		stored = ms.store.replace(key, value, uint32(flags), expires)
+	case "cas":
+		var found bool
+		stored, found = ms.store.compareAndSwap(key, cas, value, uint32(flags), expires)
+		if !found {
+			response = "NOT_FOUND"
+		} else if !stored {
+			response = "EXISTS"
+		}
+	}
+
+	if !stored && response == "STORED" {
+		response = "NOT_STORED"
+	}
+
+	return reply(w, noreply, response)
+}
+
+func (ms *MemcachedServer) delete(args []string, w *bufio.Writer) error {
+	if len(args) < 1 || len(args) > 2 {
+		return clientError(w, "bad command line format")
+	}
+
+	noreply := len(args) == 2 && args[1] == "noreply"
+	if ms.store.remove(args[0]) {
+		return reply(w, noreply, "DELETED")
+	}
+
+	return reply(w, noreply, "NOT_FOUND")
+}
+
+func (ms *MemcachedServer) touch(args []string, w *bufio.Writer) error {
+	if len(args) < 2 || len(args) > 3 {
+		return clientError(w, "bad command line format")
+	}
+
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return clientError(w, "bad command line format")
+	}
+
+	noreply := len(args) == 3 && args[2] == "noreply"
+	if ms.store.touch(args[0], memcachedExpiry(exptime)) {
+		return reply(w, noreply, "TOUCHED")
+	}
+
+	return reply(w, noreply, "NOT_FOUND")
+}
+
+func (ms *MemcachedServer) alias(args []string, w *bufio.Writer) error {
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	if len(args) < 2 {
+		return clientError(w, "bad command line format")
+	}
+
+	for _, key := range args {
+		if !validKey(key) {
+			return clientError(w, "bad key")
+		}
+	}
+
+	if ms.store.alias(args[0], args[1:]...) {
+		return reply(w, noreply, "STORED")
+	}
+
+	return reply(w, noreply, "NOT_FOUND")
+}
+
+func (ms *MemcachedServer) flushAll(args []string, w *bufio.Writer) error {
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	if len(args) > 1 {
+		return clientError(w, "bad command line format")
+	}
+
+	var delay int64
+	if len(args) == 1 {
+		var err error
+		if delay, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+			return clientError(w, "bad command line format")
+		}
+	}
+
+	if delay > 0 {
+		time.AfterFunc(time.Duration(delay)*time.Second, ms.store.flush)
+	} else {
+		ms.store.flush()
+	}
+
+	return reply(w, noreply, "OK")
+}
+
+func (ms *MemcachedServer) stats(w *bufio.Writer) error {
+	stats := ms.store.Stats()
+	cache := ms.store.Cache()
+	now := time.Now()
+
+	values := []struct {
+		name  string
+		value interface{}
+	}{
+		{"pid", os.Getpid()},
+		{"uptime", int64(now.Sub(ms.started).Seconds())},
+		{"time", now.Unix()},
+		{"version", Version},
+		{"curr_items", cache.Len()},
+		{"limit_maxitems", cache.Capacity()},
+		{"cmd_get", stats.Gets},
+		{"get_hits", stats.Hits},
+		{"get_misses", stats.Misses},
+		{"cmd_set", stats.Sets},
+		{"cmd_delete", stats.Deletes},
+		{"cmd_flush", stats.Flushes},
+	}
+
+	for _, stat := range values {
+		fmt.Fprintf(w, "STAT %s %v\r\n", stat.name, stat.value)
+	}
+
+	_, err := w.WriteString("END\r\n")
+	return err
+}
+
+// Converts a memcached exptime to an expiry time. Zero never expires, values
+// up to 30 days are relative to now, larger values are unix timestamps and
+// negative values are already expired.
+func memcachedExpiry(exptime int64) time.Time {
+	switch {
+	case exptime == 0:
+		return time.Time{}
+	case exptime < 0:
+		return time.Now()
+	case exptime <= memcachedMaxRelativeExptime:
+		return time.Now().Add(time.Duration(exptime) * time.Second)
+	}
+
+	return time.Unix(exptime, 0)
+}
+
+// Keys are limited to 250 bytes without whitespace or control characters.
+func validKey(key string) bool {
+	if len(key) == 0 || len(key) > memcachedMaxKeyLength {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+func reply(w *bufio.Writer, noreply bool, response string) error {
+	if noreply {
+		return nil
+	}
+
+	_, err := w.WriteString(response + "\r\n")
+	return err
+}
+
+// Reads a command line, failing with memcachedLineTooLong rather than
+// buffering more than memcachedMaxLineLength bytes.
+func readMemcachedLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > memcachedMaxLineLength {
+			return "", memcachedLineTooLong
+		}
+
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+func clientError(w *bufio.Writer, message string) error {
+	_, err := fmt.Fprintf(w, "CLIENT_ERROR %s\r\n", message)
+	return err
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+type MemcachedTestcase struct {
+	// Sent to the server as is
+	request string
+	// The full response expected for the request
+	expected string
+}
+
+// Starts a server on localhost and returns a connection to it.
+func startMemcached(t *testing.T) (net.Conn, func()) {
+	mc, _ := multicache.NewDefaultMulticache(10)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go NewMemcachedServer(NewStore(mc)).Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, func() {
+		conn.Close()
+		l.Close()
+	}
+}
+
+func runMemcachedTests(t *testing.T, testcases []MemcachedTestcase) {
+	conn, stop := startMemcached(t)
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+
+	for index, test := range testcases {
+		conn.Write([]byte(test.request))
+
+		expected := test.expected
+		response := ""
+		for len(response) < len(expected) {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal("Read failed, index:", index, err)
+			}
+
+			response += line
+		}
+
+		if response != expected {
+			t.Errorf("Unexpected result, index: %d request: %q response: %q expected: %q", index, test.request, response, expected)
+		}
+	}
+}
+
+func TestMemcachedStorage(t *testing.T) {
+	runMemcachedTests(t, []MemcachedTestcase{
+		{"get foo\r\n", "END\r\n"},
+		{"set foo 5 0 3\r\nbar\r\n", "STORED\r\n"},
+		{"get foo\r\n", "VALUE foo 5 3\r\nbar\r\nEND\r\n"},
+		// add only stores missing keys, replace only present ones
+		{"add foo 0 0 1\r\nx\r\n", "NOT_STORED\r\n"},
+		{"add new 0 0 1\r\nx\r\n", "STORED\r\n"},
+		{"replace missing 0 0 1\r\nx\r\n", "NOT_STORED\r\n"},
+		{"replace foo 1 0 3\r\nbaz\r\n", "STORED\r\n"},
+		{"get foo new missing\r\n", "VALUE foo 1 3\r\nbaz\r\nVALUE new 0 1\r\nx\r\nEND\r\n"},
+		// noreply suppresses the response entirely
+		{"set quiet 0 0 1 noreply\r\nq\r\nget quiet\r\n", "VALUE quiet 0 1\r\nq\r\nEND\r\n"},
+		{"delete foo\r\n", "DELETED\r\n"},
+		{"delete foo\r\n", "NOT_FOUND\r\n"},
+		{"get foo\r\n", "END\r\n"},
+	})
+}
+
+func TestMemcachedCas(t *testing.T) {
+	conn, stop := startMemcached(t)
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	readLine := func() string {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, _ := reader.ReadString('\n')
+		return line
+	}
+
+	conn.Write([]byte("set foo 0 0 1\r\na\r\ngets foo\r\n"))
+	assert(t, readLine() == "STORED\r\n", "set failed")
+
+	fields := strings.Fields(readLine())
+	assert(t, len(fields) == 5, "gets didn't return a cas value")
+	readLine()
+	readLine()
+
+	cas := fields[4]
+	conn.Write([]byte("cas foo 0 0 1 " + cas + "\r\nb\r\n"))
+	assert(t, readLine() == "STORED\r\n", "cas with current value failed")
+
+	conn.Write([]byte("cas foo 0 0 1 " + cas + "\r\nc\r\n"))
+	assert(t, readLine() == "EXISTS\r\n", "cas with stale value succeeded")
+
+	conn.Write([]byte("cas missing 0 0 1 " + cas + "\r\nc\r\n"))
+	assert(t, readLine() == "NOT_FOUND\r\n", "cas on missing key succeeded")
+}
+
+func TestMemcachedExpiry(t *testing.T) {
+	runMemcachedTests(t, []MemcachedTestcase{
+		// negative exptime expires immediately
+		{"set gone 0 -1 1\r\nx\r\n", "STORED\r\n"},
+		{"get gone\r\n", "END\r\n"},
+		{"set foo 0 100 1\r\nx\r\n", "STORED\r\n"},
+		{"touch foo -1\r\n", "TOUCHED\r\n"},
+		{"get foo\r\n", "END\r\n"},
+		{"touch foo 100\r\n", "NOT_FOUND\r\n"},
+		// absolute unix times in the past are expired too
+		{"set old 0 2592001 1\r\nx\r\n", "STORED\r\n"},
+		{"get old\r\n", "END\r\n"},
+	})
+}
+
+func TestMemcachedAlias(t *testing.T) {
+	runMemcachedTests(t, []MemcachedTestcase{
+		{"alias foo bar\r\n", "NOT_FOUND\r\n"},
+		{"set foo 3 0 1\r\nx\r\n", "STORED\r\n"},
+		{"alias foo bar baz\r\n", "STORED\r\n"},
+		{"get bar baz\r\n", "VALUE bar 3 1\r\nx\r\nVALUE baz 3 1\r\nx\r\nEND\r\n"},
+		// the aliases survive touching the item
+		{"touch baz 100\r\n", "TOUCHED\r\n"},
+		{"get foo\r\n", "VALUE foo 3 1\r\nx\r\nEND\r\n"},
+		// removing one key removes them all
+		{"delete bar\r\n", "DELETED\r\n"},
+		{"get foo baz\r\n", "END\r\n"},
+	})
+}
+
+func TestStoreAliasCopiesEntry(t *testing.T) {
+	mc, _ := multicache.NewDefaultMulticache(10)
+	store := NewStore(mc)
+	store.set([]byte("x"), 0, time.Time{}, "foo")
+
+	before, _ := store.lookup("foo")
+	store.alias("foo", "bar", "foo")
+	after, _ := store.lookup("bar")
+
+	// Cached entries are never modified
+	assert(t, len(before.keys) == 1, "Cached entry modified")
+	assert(t, after != before && strings.Join(after.keys, " ") == "foo bar", "Aliased entry has the wrong keys")
+	assert(t, after.cas == before.cas, "Aliasing changed the cas value")
+}
+
+func TestStoreTouchKeepsCAS(t *testing.T) {
+	mc, _ := multicache.NewDefaultMulticache(10)
+	store := NewStore(mc)
+	store.set([]byte("x"), 0, time.Time{}, "foo", "bar")
+
+	before, _ := store.lookup("foo")
+	expires := time.Now().Add(time.Hour)
+	store.touch("bar", expires)
+	after, _ := store.lookup("foo")
+
+	assert(t, before.expires.IsZero(), "Cached entry modified")
+	assert(t, after != before && after.expires.Equal(expires), "Touch didn't change the expiry")
+	assert(t, after.cas == before.cas, "Touch changed the cas value")
+	assert(t, strings.Join(after.keys, " ") == "foo bar", "Touch lost keys")
+}
+
+func TestMemcachedFlushAndStats(t *testing.T) {
+	runMemcachedTests(t, []MemcachedTestcase{
+		{"set foo 0 0 1\r\nx\r\n", "STORED\r\n"},
+		{"flush_all\r\n", "OK\r\n"},
+		{"get foo\r\n", "END\r\n"},
+		{"version\r\n", "VERSION " + Version + "\r\n"},
+	})
+
+	conn, stop := startMemcached(t)
+	defer stop()
+
+	conn.Write([]byte("set foo 0 0 1\r\nx\r\nget foo bar\r\nstats\r\n"))
+
+	reader := bufio.NewReader(conn)
+	stats := map[string]string{}
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := reader.ReadString('\n')
+		if err != nil || line == "END\r\n" && len(stats) > 0 {
+			break
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "STAT" {
+			stats[fields[1]] = fields[2]
+		}
+	}
+
+	assert(t, stats["cmd_get"] == "2", "Wrong get count")
+	assert(t, stats["get_hits"] == "1", "Wrong hit count")
+	assert(t, stats["get_misses"] == "1", "Wrong miss count")
+	assert(t, stats["cmd_set"] == "1", "Wrong set count")
+	assert(t, stats["curr_items"] == "1", "Wrong item count")
+	assert(t, stats["limit_maxitems"] == "10", "Wrong capacity")
+}
+
+func TestMemcachedErrors(t *testing.T) {
+	runMemcachedTests(t, []MemcachedTestcase{
+		{"bogus\r\n", "ERROR\r\n"},
+		{"get\r\n", "CLIENT_ERROR no keys given\r\n"},
+		{"set foo 0 0\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		// The data block is skipped, keeping the connection usable
+		{"set big 0 0 1048577\r\n" + strings.Repeat("x", 1048577) + "\r\n", "SERVER_ERROR object too large for cache\r\n"},
+		{"get big\r\n", "END\r\n"},
+		{"set foo 0 0 1\r\nxy\r\n", "CLIENT_ERROR bad data chunk\r\n"},
+	})
+}
+
+func TestMemcachedLineTooLong(t *testing.T) {
+	runMemcachedTests(t, []MemcachedTestcase{
+		{"get " + strings.Repeat("k", 100*1024) + "\r\n", "CLIENT_ERROR line too long\r\n"},
+	})
+}
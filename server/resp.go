@@ -0,0 +1,471 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+const (
+	// Largest array a client may send
+	respMaxArgs = 1024 * 1024
+	// Longest line, the connection is closed after a longer one
+	respMaxLineLength = 64 * 1024
+)
+
+var (
+	respProtocolError = errors.New("Protocol error")
+	respValueTooLarge = errors.New("Value too large")
+)
+
+/**
+RESPServer speaks RESP2, the Redis serialization protocol, on top of a Store
+so redis-cli and Redis client libraries can use a Multicache.
+
+Supported commands are GET, SET (with EX, PX, NX and XX), DEL, EXISTS, TTL,
+PTTL, FLUSHALL, INFO, PING, ECHO and QUIT. Commands may be pipelined.
+
+The extension command
+
+	MSETALIAS value key [key ...] [EX seconds | PX milliseconds]
+
+stores one value under several keys the way AddMany does; deleting any of the
+keys afterwards removes the value for all of them.
+
+A command with a bulk string longer than MaxValueSize is read and thrown away
+without being run, and the client gets an error.
+**/
+type RESPServer struct {
+	// Largest bulk string a client may send, DefaultMaxValueSize unless changed
+	MaxValueSize int
+
+	store   *Store
+	started time.Time
+}
+
+// Creates a RESP front end for the given store.
+func NewRESPServer(store *Store) *RESPServer {
+	return &RESPServer{MaxValueSize: DefaultMaxValueSize, store: store, started: time.Now()}
+}
+
+// Listens on the TCP network address addr and serves connections.
+func (rs *RESPServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return rs.Serve(l)
+}
+
+// Serves each connection accepted on l in its own goroutine. Serve returns
+// when l returns an error, e.g. because it was closed.
+func (rs *RESPServer) Serve(l net.Listener) error {
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		go rs.ServeConn(conn)
+	}
+}
+
+// Handles commands on conn until the client quits or disconnects.
+func (rs *RESPServer) ServeConn(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		args, err := readRESPCommand(reader, rs.MaxValueSize)
+		if err == respValueTooLarge {
+			// The command was read in full, so the connection is still usable.
+			writeRESPError(writer, "ERR value too large")
+			if reader.Buffered() == 0 && writer.Flush() != nil {
+				return
+			}
+
+			continue
+		} else if err == respProtocolError {
+			writeRESPError(writer, "ERR Protocol error")
+			writer.Flush()
+			return
+		} else if err != nil {
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		if strings.ToUpper(args[0]) == "QUIT" {
+			writeRESPSimple(writer, "OK")
+			writer.Flush()
+			return
+		}
+
+		rs.dispatch(args, writer)
+
+		// Only flush once the client has stopped pipelining commands.
+		if reader.Buffered() == 0 {
+			if writer.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+func (rs *RESPServer) dispatch(args []string, w *bufio.Writer) {
+	command := strings.ToUpper(args[0])
+	args = args[1:]
+
+	switch command {
+	case "PING":
+		if len(args) == 0 {
+			writeRESPSimple(w, "PONG")
+		} else {
+			writeRESPBulk(w, []byte(args[0]))
+		}
+	case "ECHO":
+		if len(args) != 1 {
+			writeRESPArity(w, command)
+			return
+		}
+
+		writeRESPBulk(w, []byte(args[0]))
+	case "GET":
+		if len(args) != 1 {
+			writeRESPArity(w, command)
+			return
+		}
+
+		if e, ok := rs.store.get(args[0]); ok {
+			writeRESPBulk(w, e.value)
+		} else {
+			writeRESPNull(w)
+		}
+	case "SET":
+		rs.set(args, w)
+	case "MSETALIAS":
+		rs.msetAlias(args, w)
+	case "DEL":
+		if len(args) == 0 {
+			writeRESPArity(w, command)
+			return
+		}
+
+		removed := 0
+		for _, key := range args {
+			if rs.store.remove(key) {
+				removed++
+			}
+		}
+
+		writeRESPInteger(w, int64(removed))
+	case "EXISTS":
+		if len(args) == 0 {
+			writeRESPArity(w, command)
+			return
+		}
+
+		found := 0
+		for _, key := range args {
+			if _, ok := rs.store.lookup(key); ok {
+				found++
+			}
+		}
+
+		writeRESPInteger(w, int64(found))
+	case "TTL", "PTTL":
+		if len(args) != 1 {
+			writeRESPArity(w, command)
+			return
+		}
+
+		unit := time.Second
+		if command == "PTTL" {
+			unit = time.Millisecond
+		}
+
+		writeRESPInteger(w, rs.ttl(args[0], unit))
+	case "FLUSHALL", "FLUSHDB":
+		rs.store.flush()
+		writeRESPSimple(w, "OK")
+	case "INFO":
+		writeRESPBulk(w, []byte(rs.info()))
+	default:
+		writeRESPError(w, fmt.Sprintf("ERR unknown command '%s'", strings.ToLower(command)))
+	}
+}
+
+// SET key value [EX seconds | PX milliseconds] [NX | XX]
+func (rs *RESPServer) set(args []string, w *bufio.Writer) {
+	if len(args) < 2 {
+		writeRESPArity(w, "SET")
+		return
+	}
+
+	key, value := args[0], []byte(args[1])
+
+	var expires time.Time
+	var onlyIfMissing, onlyIfPresent bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			onlyIfMissing = true
+		case "XX":
+			onlyIfPresent = true
+		case "EX", "PX":
+			if i+1 >= len(args) || !expires.IsZero() {
+				writeRESPError(w, "ERR syntax error")
+				return
+			}
+
+			var ok bool
+			if expires, ok = respExpiry(args[i], args[i+1]); !ok {
+				writeRESPError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+			i++
+		default:
+			writeRESPError(w, "ERR syntax error")
+			return
+		}
+	}
+
+	stored := true
+	switch {
+	case onlyIfMissing && onlyIfPresent:
+		writeRESPError(w, "ERR syntax error")
+		return
+	case onlyIfMissing:
+		stored = rs.store.add(key, value, 0, expires)
+	case onlyIfPresent:
+		stored = rs.store.replace(key, value, 0, expires)
+	default:
+		rs.store.set(value, 0, expires, key)
+	}
+
+	if stored {
+		writeRESPSimple(w, "OK")
+	} else {
+		writeRESPNull(w)
+	}
+}
+
+// MSETALIAS value key [key ...] [EX seconds | PX milliseconds]
+func (rs *RESPServer) msetAlias(args []string, w *bufio.Writer) {
+	if len(args) < 2 {
+		writeRESPArity(w, "MSETALIAS")
+		return
+	}
+
+	value, keys := []byte(args[0]), args[1:]
+
+	var expires time.Time
+	if len(keys) >= 3 {
+		option := strings.ToUpper(keys[len(keys)-2])
+		if option == "EX" || option == "PX" {
+			var ok bool
+			if expires, ok = respExpiry(option, keys[len(keys)-1]); !ok {
+				writeRESPError(w, "ERR invalid expire time in 'msetalias' command")
+				return
+			}
+
+			keys = keys[:len(keys)-2]
+		}
+	}
+
+	rs.store.set(value, 0, expires, keys...)
+	writeRESPSimple(w, "OK")
+}
+
+// Returns the time key has left to live in the given unit, -1 if it never
+// expires and -2 if it doesn't exist.
+func (rs *RESPServer) ttl(key string, unit time.Duration) int64 {
+	e, ok := rs.store.lookup(key)
+	if !ok {
+		return -2
+	}
+
+	if e.expires.IsZero() {
+		return -1
+	}
+
+	// Round to the nearest unit like Redis does.
+	remaining := e.expires.Sub(time.Now())
+	return int64((remaining + unit/2) / unit)
+}
+
+func (rs *RESPServer) info() string {
+	stats := rs.store.Stats()
+	cache := rs.store.Cache()
+
+	lines := []string{
+		"# Server",
+		"multicache_version:" + Version,
+		fmt.Sprintf("uptime_in_seconds:%d", int64(time.Since(rs.started).Seconds())),
+		"",
+		"# Stats",
+		fmt.Sprintf("total_commands_get:%d", stats.Gets),
+		fmt.Sprintf("keyspace_hits:%d", stats.Hits),
+		fmt.Sprintf("keyspace_misses:%d", stats.Misses),
+		fmt.Sprintf("total_commands_set:%d", stats.Sets),
+		fmt.Sprintf("total_commands_del:%d", stats.Deletes),
+		fmt.Sprintf("total_commands_flush:%d", stats.Flushes),
+		"",
+		"# Memory",
+		fmt.Sprintf("items:%d", cache.Len()),
+		fmt.Sprintf("maxitems:%d", cache.Capacity()),
+	}
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// Converts an EX or PX option to an expiry time.
+func respExpiry(option, amount string) (time.Time, bool) {
+	n, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+
+	unit := time.Second
+	if strings.ToUpper(option) == "PX" {
+		unit = time.Millisecond
+	}
+
+	return time.Now().Add(time.Duration(n) * unit), true
+}
+
+/**
+Reads one command, either a RESP array of bulk strings or an inline command
+separated by spaces as typed into telnet.
+
+Bulk strings longer than maxBulk are discarded and the rest of the command is
+still read, then respValueTooLarge is returned.
+**/
+func readRESPCommand(r *bufio.Reader, maxBulk int) ([]string, error) {
+	line, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count > respMaxArgs {
+		return nil, respProtocolError
+	}
+
+	// Null and empty arrays are skipped like Redis does. args grows as
+	// arguments arrive rather than trusting the count the client sent.
+	var args []string
+	tooLarge := false
+	for i := 0; i < count; i++ {
+		header, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(header) == 0 || header[0] != '$' {
+			return nil, respProtocolError
+		}
+
+		length, err := strconv.Atoi(header[1:])
+		if err != nil || length < 0 {
+			return nil, respProtocolError
+		}
+
+		if length > maxBulk {
+			if _, err := io.CopyN(io.Discard, r, int64(length)+2); err != nil {
+				return nil, err
+			}
+
+			tooLarge = true
+			continue
+		}
+
+		// The buffer grows as data arrives rather than trusting the length.
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, r, int64(length)+2); err != nil {
+			return nil, err
+		}
+
+		if !bytes.HasSuffix(data.Bytes(), []byte("\r\n")) {
+			return nil, respProtocolError
+		}
+
+		args = append(args, string(data.Bytes()[:length]))
+	}
+
+	if tooLarge {
+		return nil, respValueTooLarge
+	}
+
+	return args, nil
+}
+
+// Reads a line without its trailing CRLF, failing with respProtocolError
+// rather than buffering a line longer than respMaxLineLength.
+func readRESPLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > respMaxLineLength {
+			return "", respProtocolError
+		}
+
+		line = append(line, chunk...)
+		if err == nil {
+			return strings.TrimRight(string(line), "\r\n"), nil
+		} else if err != bufio.ErrBufferFull {
+			return "", err
+		}
+	}
+}
+
+func writeRESPSimple(w *bufio.Writer, s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+func writeRESPError(w *bufio.Writer, s string) {
+	w.WriteString("-" + s + "\r\n")
+}
+
+func writeRESPArity(w *bufio.Writer, command string) {
+	writeRESPError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(command)))
+}
+
+func writeRESPInteger(w *bufio.Writer, n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func writeRESPBulk(w *bufio.Writer, b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func writeRESPNull(w *bufio.Writer) {
+	w.WriteString("$-1\r\n")
+}
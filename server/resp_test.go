@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// A minimal RESP2 client, replies are returned as string, int64, nil, error
+// or []interface{}.
+type respClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func startRESP(t *testing.T) (*respClient, func()) {
+	mc, _ := multicache.NewDefaultMulticache(10)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go NewRESPServer(NewStore(mc)).Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &respClient{conn, bufio.NewReader(conn)}
+	return client, func() {
+		conn.Close()
+		l.Close()
+	}
+}
+
+func (c *respClient) send(args ...string) {
+	fmt.Fprintf(c.conn, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.conn, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+func (c *respClient) receive() interface{} {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	line, err := readRESPLine(c.reader)
+	if err != nil {
+		return err
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return fmt.Errorf("%s", line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		length, _ := strconv.Atoi(line[1:])
+		if length < 0 {
+			return nil
+		}
+
+		data := make([]byte, length+2)
+		io.ReadFull(c.reader, data)
+		return string(data[:length])
+	case '*':
+		count, _ := strconv.Atoi(line[1:])
+		reply := []interface{}{}
+		for i := 0; i < count; i++ {
+			reply = append(reply, c.receive())
+		}
+		return reply
+	}
+
+	return fmt.Errorf("bad reply %q", line)
+}
+
+func (c *respClient) do(args ...string) interface{} {
+	c.send(args...)
+	return c.receive()
+}
+
+type RESPTestcase struct {
+	command  []string
+	expected interface{}
+}
+
+func runRESPTests(t *testing.T, testcases []RESPTestcase) {
+	client, stop := startRESP(t)
+	defer stop()
+
+	for index, test := range testcases {
+		reply := client.do(test.command...)
+
+		if fmt.Sprint(reply) != fmt.Sprint(test.expected) {
+			t.Error("Unexpected result, index:", index, "command:", test.command, "reply:", reply, "expected:", test.expected)
+		}
+	}
+}
+
+func TestRESPGetSetDel(t *testing.T) {
+	runRESPTests(t, []RESPTestcase{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"GET", "foo"}, nil},
+		{[]string{"SET", "foo", "bar"}, "OK"},
+		{[]string{"get", "foo"}, "bar"},
+		{[]string{"SET", "foo", "baz", "NX"}, nil},
+		{[]string{"SET", "new", "1", "NX"}, "OK"},
+		{[]string{"SET", "missing", "1", "XX"}, nil},
+		{[]string{"SET", "foo", "qux", "XX"}, "OK"},
+		{[]string{"GET", "foo"}, "qux"},
+		{[]string{"EXISTS", "foo", "new", "missing"}, int64(2)},
+		{[]string{"DEL", "foo", "new", "missing"}, int64(2)},
+		{[]string{"EXISTS", "foo"}, int64(0)},
+	})
+}
+
+func TestRESPExpiry(t *testing.T) {
+	runRESPTests(t, []RESPTestcase{
+		{[]string{"TTL", "foo"}, int64(-2)},
+		{[]string{"SET", "foo", "bar"}, "OK"},
+		{[]string{"TTL", "foo"}, int64(-1)},
+		{[]string{"SET", "foo", "bar", "EX", "100"}, "OK"},
+		{[]string{"TTL", "foo"}, int64(100)},
+		{[]string{"SET", "foo", "bar", "PX", "100000"}, "OK"},
+		{[]string{"TTL", "foo"}, int64(100)},
+		{[]string{"SET", "foo", "bar", "EX", "0"}, fmt.Errorf("ERR invalid expire time in 'set' command")},
+		{[]string{"SET", "foo", "bar", "EX"}, fmt.Errorf("ERR syntax error")},
+	})
+
+	client, stop := startRESP(t)
+	defer stop()
+
+	client.do("SET", "short", "bar", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+	assert(t, client.do("GET", "short") == nil, "Got expired value")
+	assert(t, client.do("TTL", "short") == int64(-2), "Expired value has a TTL")
+}
+
+func TestRESPMSetAlias(t *testing.T) {
+	runRESPTests(t, []RESPTestcase{
+		{[]string{"MSETALIAS", "shared", "a", "b", "c"}, "OK"},
+		{[]string{"GET", "a"}, "shared"},
+		{[]string{"GET", "c"}, "shared"},
+		// Deleting any key removes the item for all of them
+		{[]string{"DEL", "b", "a"}, int64(1)},
+		{[]string{"GET", "c"}, nil},
+		{[]string{"MSETALIAS", "timed", "x", "y", "EX", "50"}, "OK"},
+		{[]string{"TTL", "y"}, int64(50)},
+		{[]string{"EXISTS", "EX"}, int64(0)},
+		{[]string{"MSETALIAS", "v"}, fmt.Errorf("ERR wrong number of arguments for 'msetalias' command")},
+	})
+}
+
+func TestRESPFlushAndInfo(t *testing.T) {
+	runRESPTests(t, []RESPTestcase{
+		{[]string{"SET", "foo", "bar"}, "OK"},
+		{[]string{"FLUSHALL"}, "OK"},
+		{[]string{"GET", "foo"}, nil},
+		{[]string{"BOGUS"}, fmt.Errorf("ERR unknown command 'bogus'")},
+	})
+
+	client, stop := startRESP(t)
+	defer stop()
+
+	client.do("SET", "foo", "bar")
+	client.do("GET", "foo")
+	info, _ := client.do("INFO").(string)
+	assert(t, len(info) > 0, "INFO returned nothing")
+	assert(t, strings.Contains(info, "\r\nkeyspace_hits:1\r\n"), "INFO missing hits")
+	assert(t, strings.Contains(info, "\r\nitems:1\r\n"), "INFO missing items")
+}
+
+func TestRESPPipelining(t *testing.T) {
+	client, stop := startRESP(t)
+	defer stop()
+
+	// Send everything before reading any replies
+	client.send("SET", "a", "1")
+	client.send("SET", "b", "2")
+	client.send("GET", "a")
+	client.send("GET", "b")
+	client.send("DEL", "a")
+	client.conn.Write([]byte("PING\r\n"))
+
+	expected := []interface{}{"OK", "OK", "1", "2", int64(1), "PONG"}
+	for index, want := range expected {
+		reply := client.receive()
+		assert(t, reply == want, fmt.Sprint("Pipelined reply wrong, index: ", index, " reply: ", reply))
+	}
+}
+
+func TestRESPProtocolError(t *testing.T) {
+	client, stop := startRESP(t)
+	defer stop()
+
+	client.conn.Write([]byte("*1\r\n+PING\r\n"))
+	_, ok := client.receive().(error)
+	assert(t, ok, "Malformed command accepted")
+}
+
+func TestRESPNullArray(t *testing.T) {
+	client, stop := startRESP(t)
+	defer stop()
+
+	client.conn.Write([]byte("*-1\r\n*0\r\n"))
+	reply := client.do("PING")
+	assert(t, reply == "PONG", fmt.Sprint("Null array not skipped, reply: ", reply))
+}
+
+func TestRESPValueTooLarge(t *testing.T) {
+	client, stop := startRESP(t)
+	defer stop()
+
+	big := strings.Repeat("a", DefaultMaxValueSize+1)
+	go client.send("SET", "big", big)
+
+	reply, ok := client.receive().(error)
+	assert(t, ok && reply.Error() == "ERR value too large", fmt.Sprint("Oversized value accepted, reply: ", reply))
+	assert(t, client.do("GET", "big") == nil, "Oversized value stored")
+	assert(t, client.do("PING") == "PONG", "Connection unusable after an oversized value")
+}
+
+func TestRESPLineTooLong(t *testing.T) {
+	client, stop := startRESP(t)
+	defer stop()
+
+	go client.conn.Write([]byte(strings.Repeat("a", 2*respMaxLineLength)))
+
+	reply, ok := client.receive().(error)
+	assert(t, ok && reply.Error() == "ERR Protocol error", fmt.Sprint("Long line accepted, reply: ", reply))
+}
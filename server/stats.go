@@ -0,0 +1,58 @@
+package server
+
+import "sync/atomic"
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+/**
+Stats counts the requests a server has handled. The counters are updated
+atomically so a single Stats can be shared between connections.
+**/
+type Stats struct {
+	Gets    uint64 `json:"gets"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Sets    uint64 `json:"sets"`
+	Deletes uint64 `json:"deletes"`
+	Flushes uint64 `json:"flushes"`
+}
+
+// Records the result of a lookup.
+func (s *Stats) recordGet(hit bool) {
+	atomic.AddUint64(&s.Gets, 1)
+	if hit {
+		atomic.AddUint64(&s.Hits, 1)
+	} else {
+		atomic.AddUint64(&s.Misses, 1)
+	}
+}
+
+func (s *Stats) recordSet() {
+	atomic.AddUint64(&s.Sets, 1)
+}
+
+func (s *Stats) recordDelete() {
+	atomic.AddUint64(&s.Deletes, 1)
+}
+
+func (s *Stats) recordFlush() {
+	atomic.AddUint64(&s.Flushes, 1)
+}
+
+// Returns a copy of the counters that is safe to read.
+func (s *Stats) Snapshot() Stats {
+	return Stats{
+		Gets:    atomic.LoadUint64(&s.Gets),
+		Hits:    atomic.LoadUint64(&s.Hits),
+		Misses:  atomic.LoadUint64(&s.Misses),
+		Sets:    atomic.LoadUint64(&s.Sets),
+		Deletes: atomic.LoadUint64(&s.Deletes),
+		Flushes: atomic.LoadUint64(&s.Flushes),
+	}
+}
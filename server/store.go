@@ -0,0 +1,275 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+// Largest value the network front ends accept unless configured otherwise
+const DefaultMaxValueSize = 1024 * 1024
+
+// Incremented for every stored entry so compare-and-swap can detect changes.
+var casCounter uint64
+
+/**
+entry is the value the front ends store in the Multicache. Entries are never
+modified once they are in the cache; changing the expiry or key set stores a
+copy, which lets lookups run without holding the Store's lock.
+**/
+type entry struct {
+	value []byte
+	// Opaque client flags, only used by the memcached protocol
+	flags uint32
+	// Unique per stored entry, changes whenever the item is replaced
+	cas uint64
+	// When the entry stops being served, the zero time means never
+	expires time.Time
+	// Every key the entry was stored under, so it can be re-added
+	keys []string
+}
+
+// True if the entry should no longer be served at the given time.
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+/**
+Store is the view of a Multicache shared by the network front ends. Commands
+that read before they write, such as memcached's add or cas, run under the
+Store's lock so they are atomic with respect to every front end built on the
+same Store.
+
+Values written by one protocol can be read by any other.
+**/
+type Store struct {
+	cache *multicache.Multicache
+	lock  sync.Mutex
+	stats Stats
+}
+
+// Creates a Store serving the given cache.
+func NewStore(cache *multicache.Multicache) *Store {
+	return &Store{cache: cache}
+}
+
+// Returns the cache behind the store.
+func (s *Store) Cache() *multicache.Multicache {
+	return s.cache
+}
+
+// Returns the counters for the commands served so far.
+func (s *Store) Stats() Stats {
+	return s.stats.Snapshot()
+}
+
+// Looks up a live entry, recording the hit or miss.
+func (s *Store) get(key string) (*entry, bool) {
+	e, ok := s.lookup(key)
+	s.stats.recordGet(ok)
+	return e, ok
+}
+
+// Looks up a live entry without touching the counters. Expired entries are
+// removed so they stop taking up a slot.
+func (s *Store) lookup(key string) (*entry, bool) {
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := value.(*entry)
+	if e.expired(time.Now()) {
+		s.removeIfCurrent(key, e)
+		return nil, false
+	}
+
+	return e, true
+}
+
+// Removes key if it still refers to e, a newer entry is left alone.
+func (s *Store) removeIfCurrent(key string, e *entry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if value, ok := s.cache.Get(key); ok && value.(*entry) == e {
+		s.cache.Remove(key)
+	}
+}
+
+// Stores a new entry under every key. Must be called with the lock held.
+func (s *Store) put(value []byte, flags uint32, expires time.Time, keys []string) *entry {
+	e := &entry{
+		value:   value,
+		flags:   flags,
+		cas:     atomic.AddUint64(&casCounter, 1),
+		expires: expires,
+		keys:    keys,
+	}
+
+	s.cache.AddMany(e, keys...)
+	return e
+}
+
+// Unconditionally stores value under the given keys.
+func (s *Store) set(value []byte, flags uint32, expires time.Time, keys ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.put(value, flags, expires, dedupeKeys(keys))
+	s.stats.recordSet()
+}
+
+// Stores value only if key isn't already present.
+func (s *Store) add(key string, value []byte, flags uint32, expires time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.lookupLocked(key); ok {
+		return false
+	}
+
+	s.put(value, flags, expires, []string{key})
+	s.stats.recordSet()
+	return true
+}
+
+// Stores value only if key is already present.
+func (s *Store) replace(key string, value []byte, flags uint32, expires time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.lookupLocked(key); !ok {
+		return false
+	}
+
+	s.put(value, flags, expires, []string{key})
+	s.stats.recordSet()
+	return true
+}
+
+// Stores value only if the entry under key still has the given cas value.
+// found is false if there was no such entry.
+func (s *Store) compareAndSwap(key string, cas uint64, value []byte, flags uint32, expires time.Time) (stored, found bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.lookupLocked(key)
+	if !ok {
+		return false, false
+	}
+
+	if e.cas != cas {
+		return false, true
+	}
+
+	s.put(value, flags, expires, []string{key})
+	s.stats.recordSet()
+	return true, true
+}
+
+// Changes the expiry of the item under key, keeping all of its keys and its
+// cas value.
+func (s *Store) touch(key string, expires time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.lookupLocked(key)
+	if !ok {
+		return false
+	}
+
+	// Store a copy with the new expiry, it keeps its cas value
+	touched := *e
+	touched.expires = expires
+	touched.keys = s.cache.KeysOf(key)
+	s.cache.AddMany(&touched, touched.keys...)
+	return true
+}
+
+// Makes the item under key reachable through newKeys as well. Any other
+// items stored under newKeys are replaced.
+func (s *Store) alias(key string, newKeys ...string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.lookupLocked(key)
+	if !ok {
+		return false
+	}
+
+	// Store a copy with the new keys, it keeps its cas value
+	aliased := *e
+	aliased.keys = dedupeKeys(append(s.cache.KeysOf(key), newKeys...))
+	s.cache.AddMany(&aliased, aliased.keys...)
+	return true
+}
+
+// Removes the item under key and all of its other keys.
+func (s *Store) remove(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.lookupLocked(key)
+	s.cache.Remove(key)
+	s.stats.recordDelete()
+	return ok
+}
+
+// Removes everything from the cache.
+func (s *Store) flush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.cache.Purge()
+	s.stats.recordFlush()
+}
+
+// Like lookup but for callers already holding the lock.
+func (s *Store) lookupLocked(key string) (*entry, bool) {
+	value, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := value.(*entry)
+	if e.expired(time.Now()) {
+		s.cache.Remove(key)
+		return nil, false
+	}
+
+	return e, true
+}
+
+// AddMany is undefined for duplicate keys so they are dropped here, keeping
+// the first occurrence of each.
+func dedupeKeys(keys []string) []string {
+	out := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key != "" && !containsString(out, key) {
+			out = append(out, key)
+		}
+	}
+
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package multicache
+
+import "sync/atomic"
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+/**
+Sieve is the SIEVE algorithm. Like SecondChance a bit is set on items when
+they're accessed, but items are kept in the order they were inserted and a
+hand moves from the oldest towards the newest looking for an item without the
+bit, clearing it on the items it passes. New items go in as the newest rather
+than where the hand is, so items that are never read again are replaced
+quickly while popular ones stay put.
+
+The accessed bit is set atomically so Gets only take the read lock, see
+ConcurrentRetriever.
+**/
+type Sieve struct {
+	order slotQueue
+	hand  Slot
+}
+
+func (rof *Sieve) InitItem(item *MulticacheItem) {
+	atomic.StoreInt64(&item.Tag, 0)
+
+	// Items put in a slot freed by a removal are the newest, the hand
+	// mustn't follow them there.
+	if rof.hand == item.slot {
+		rof.hand = rof.order.succ[item.slot]
+	}
+
+	rof.order.moveToBack(item.slot)
+}
+
+func (rof *Sieve) Reset(multicache *Multicache) {
+	rof.order.reset(len(multicache.itemList))
+	rof.hand = rof.order.head
+}
+
+func (rof *Sieve) GetNextReplacement(multicache *Multicache) *MulticacheItem {
+	for {
+		currentItem := multicache.itemList[rof.hand]
+		rof.hand = rof.order.succ[rof.hand]
+
+		// This item hasn't been referenced since the hand last passed
+		if atomic.LoadInt64(&currentItem.Tag) == 0 {
+			return currentItem
+		}
+
+		atomic.StoreInt64(&currentItem.Tag, 0)
+	}
+}
+
+func (rof *Sieve) UpdatesOnRetrieved() bool {
+	return true
+}
+
+func (rof *Sieve) ItemRetrieved(item *MulticacheItem) bool {
+	// Skip the store if the bit is already set so hot items don't bounce
+	// between processors.
+	if atomic.LoadInt64(&item.Tag) == 0 {
+		atomic.StoreInt64(&item.Tag, 1)
+	}
+
+	return true
+}
+
+func (rof *Sieve) RetrievesConcurrently() bool {
+	return true
+}
+
+func (rof *Sieve) MarksReferences() bool {
+	return true
+}
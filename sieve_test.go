@@ -0,0 +1,29 @@
+package multicache
+
+import "testing"
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+var sieveTestCases = []ReplacementAlgorithmTestcase{
+	// Miss all items because they aren't in cache
+	{&Sieve{}, 4, []string{"a", "b", "c", "d", "e"}, []bool{false, false, false, false, false}, 0},
+	// Overwrite the first element and try it again
+	{&Sieve{}, 3, []string{"a", "b", "c", "d", "a"}, []bool{false, false, false, false, false}, 0},
+	// Hit things
+	{&Sieve{}, 2, []string{"a", "b", "a", "b"}, []bool{false, false, true, true}, 0},
+	// The hand passes over a, replacing b then c
+	{&Sieve{}, 3, []string{"a", "b", "c", "a", "d", "a", "e", "a", "c"}, []bool{false, false, false, true, false, true, false, true, false}, 0},
+	// Items the hand passes lose their bit, so a and b go before e
+	{&Sieve{}, 3, []string{"a", "b", "c", "a", "b", "d", "e", "f", "e"}, []bool{false, false, false, true, true, false, false, false, true}, 0}}
+
+func TestSieve(t *testing.T) {
+	for _, testcase := range sieveTestCases {
+		testcase.RunTest(t)
+	}
+}
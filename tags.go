@@ -0,0 +1,86 @@
+package multicache
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+/**
+Adds an item to the cache with the given keys and tags, such as "user:42" or
+"catalog", so every item with a tag can be removed at once with RemoveByTag.
+The cache keeps an index from each tag to its items, which is updated as items
+leave the cache however they're removed.
+
+NOTE: do not include duplicate keys, like AddMany.
+**/
+func (mc *Multicache) AddTagged(value interface{}, tags []string, keys ...string) {
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	item := mc.add(value, keys...)
+	if item == nil {
+		return
+	}
+
+	item.tags = append([]string{}, tags...)
+	for _, tag := range item.tags {
+		items, ok := mc.tagged[tag]
+		if !ok {
+			items = make(map[*MulticacheItem]struct{})
+			mc.tagged[tag] = items
+		}
+
+		items[item] = struct{}{}
+	}
+}
+
+/**
+Removes every item with the given tag, returning how many were removed. It
+takes time proportional to the number of matching items, not the size of the
+cache. Removed items are reported to the RemoveListener like Remove.
+**/
+func (mc *Multicache) RemoveByTag(tag string) int {
+	mc.writeLock()
+	defer mc.lock.Unlock()
+
+	items := mc.tagged[tag]
+	removed := len(items)
+
+	// removeItem edits the index so take the whole set first
+	delete(mc.tagged, tag)
+	for item := range items {
+		mc.notifyRemoved(item.keys)
+		mc.removeItem(item, RemoveExplicit)
+	}
+
+	return removed
+}
+
+// Returns the tags of the item with the given key, nil if there isn't one.
+func (mc *Multicache) Tags(key string) []string {
+	mc.readLock()
+	defer mc.lock.RUnlock()
+
+	item, ok := mc.kvStore[key]
+	if !ok {
+		return nil
+	}
+
+	return append([]string(nil), item.tags...)
+}
+
+// Drops item from the index of tag.
+func (mc *Multicache) untag(tag string, item *MulticacheItem) {
+	items, ok := mc.tagged[tag]
+	if !ok {
+		return
+	}
+
+	delete(items, item)
+	if len(items) == 0 {
+		delete(mc.tagged, tag)
+	}
+}
@@ -0,0 +1,76 @@
+package multicache
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func TestRemoveByTag(t *testing.T) {
+	mc, _ := NewDefaultMulticache(10)
+
+	removed := [][]string{}
+	mc.SetRemoveListener(func(keys []string) {
+		removed = append(removed, keys)
+	})
+
+	mc.AddTagged(1, []string{"user:42", "catalog"}, "a", "a-alias")
+	mc.AddTagged(2, []string{"user:42"}, "b")
+	mc.AddTagged(3, []string{"catalog"}, "c")
+	mc.Add("d", 4)
+
+	assert(t, reflect.DeepEqual(mc.Tags("a-alias"), []string{"user:42", "catalog"}), "Wrong tags")
+	assert(t, mc.Tags("d") == nil && mc.Tags("missing") == nil, "Untagged item has tags")
+
+	assert(t, mc.RemoveByTag("user:42") == 2, "Wrong number of items removed")
+	for _, key := range []string{"a", "a-alias", "b"} {
+		_, ok := mc.Get(key)
+		assert(t, !ok, "Tagged item kept")
+	}
+
+	assert(t, len(removed) == 2, "Removals not reported")
+
+	// a left the catalog tag along with the cache
+	assert(t, len(mc.tagged["catalog"]) == 1, "Removed item left in another tag")
+	assert(t, mc.RemoveByTag("catalog") == 1, "Wrong number of catalog items removed")
+	assert(t, mc.RemoveByTag("catalog") == 0, "Tag kept after removal")
+
+	_, ok := mc.Get("d")
+	assert(t, ok, "Untagged item removed")
+}
+
+func TestTagIndexFollowsRemovals(t *testing.T) {
+	mc, _ := NewMulticache(2, &RoundRobin{})
+
+	for i := 0; i < 10; i++ {
+		mc.AddTagged(i, []string{"all", "item:" + strconv.Itoa(i)}, strconv.Itoa(i))
+	}
+
+	// Only the items still cached are indexed
+	tags := []string{}
+	for tag := range mc.tagged {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	assert(t, reflect.DeepEqual(tags, []string{"all", "item:8", "item:9"}), "Evicted items left in the index")
+	assert(t, len(mc.tagged["all"]) == 2, "Wrong items for tag")
+
+	// Overwriting drops the old item's tags
+	mc.AddTagged("new", []string{"other"}, "9")
+	_, ok := mc.tagged["item:9"]
+	assert(t, !ok, "Overwritten item left in the index")
+
+	mc.Remove("8")
+	mc.Purge()
+	assert(t, len(mc.tagged) == 0, "Purge left tags")
+	assert(t, mc.RemoveByTag("all") == 0, "Purged items removed")
+}
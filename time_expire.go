@@ -34,8 +34,10 @@ func (this *TimedExpire) GetNextReplacement(multicache *Multicache) *MulticacheI
 
 	currentTimeMs := time.Now().UnixNano() / int64(time.Millisecond)
 
-	var difference int64 = 0
-	var smallestItem *MulticacheItem
+	// Start with the first item so there's a replacement even when every item
+	// was inserted this millisecond.
+	smallestItem := multicache.itemList[0]
+	difference := currentTimeMs - smallestItem.Tag
 
 	for _, item := range multicache.itemList {
 		// item.Tag has the creation time of this item
@@ -27,3 +27,17 @@ func TestTimedExpire(t *testing.T) {
 		testcase.RunTest(t)
 	}
 }
+
+func TestTimedExpireFullCacheSameMillisecond(t *testing.T) {
+	mc, _ := CreateTimeExpireMulticache(2, 1000)
+
+	// Every item is inserted well within a millisecond of the others, one
+	// still has to be replaced.
+	for i := 0; i < 10; i++ {
+		mc.Add(string(rune('a'+i)), i)
+	}
+
+	_, ok := mc.Get("j")
+	assert(t, ok, "Newest item not cached")
+	assert(t, mc.Len() == 2, "Cache should be full")
+}
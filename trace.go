@@ -0,0 +1,411 @@
+package multicache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+var (
+	InvalidTraceError = errors.New("Invalid trace data")
+)
+
+// Starts every binary trace so readers can tell the formats apart.
+const binaryTraceMagic = "MCTRACE1"
+
+// Most keys in a binary trace event, and the longest key, rejecting corrupt
+// lengths before they're allocated.
+const binaryTraceMaxLength = 1 << 24
+
+// The operation a TraceEvent records
+type TraceOp byte
+
+const (
+	TraceGet    TraceOp = 'G'
+	TraceAdd    TraceOp = 'A'
+	TraceRemove TraceOp = 'R'
+)
+
+// A single cache operation in a trace.
+type TraceEvent struct {
+	// When the operation happened, may be the zero time if unknown
+	Time time.Time
+	Op   TraceOp
+	// The key looked up followed by any aliases of its item, the keys
+	// removed, or every key of an added item
+	Keys []string
+	// Size of the item in bytes if the trace records it, otherwise 0. The
+	// text and binary formats don't store sizes.
+	Size int64
+}
+
+/**
+TraceReader returns the events of a trace one at a time so traces far larger
+than memory can be processed. Read returns io.EOF after the last event.
+**/
+type TraceReader interface {
+	Read() (TraceEvent, error)
+}
+
+// TraceWriter appends events to a trace. Flush must be called once done.
+type TraceWriter interface {
+	Write(event TraceEvent) error
+	Flush() error
+}
+
+/**
+Returns a TraceReader for r, detecting whether r holds a binary or a text
+trace.
+**/
+func NewTraceReader(r io.Reader) (TraceReader, error) {
+	buffered := bufio.NewReader(r)
+
+	magic, err := buffered.Peek(len(binaryTraceMagic))
+	if err == nil && string(magic) == binaryTraceMagic {
+		return newBinaryTraceReader(buffered)
+	}
+
+	return newTextTraceReader(buffered), nil
+}
+
+/** Text traces hold one event per line:
+
+	<unix nanoseconds> <G|A|R> <key> [<key>...]
+
+A time of 0 means the time is unknown. Keys are escaped so they never contain
+ASCII whitespace or a %, other characters such as Unicode spaces are kept as
+they are. A line holding only a key is a Get with an unknown time, so plain
+lists of keys are valid traces. Blank lines and lines starting with # are
+ignored.
+**/
+type textTraceReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// Reads a text trace from r.
+func NewTextTraceReader(r io.Reader) TraceReader {
+	return newTextTraceReader(r)
+}
+
+func newTextTraceReader(r io.Reader) *textTraceReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &textTraceReader{scanner: scanner}
+}
+
+func (t *textTraceReader) Read() (TraceEvent, error) {
+	for t.scanner.Scan() {
+		t.line++
+		fields := strings.FieldsFunc(t.scanner.Text(), isTraceSpace)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) == 1 {
+			key, err := url.PathUnescape(fields[0])
+			if err != nil {
+				return TraceEvent{}, t.error(err)
+			}
+
+			return TraceEvent{Op: TraceGet, Keys: []string{key}}, nil
+		}
+
+		if len(fields) < 3 || len(fields[1]) != 1 {
+			return TraceEvent{}, t.error(InvalidTraceError)
+		}
+
+		nanos, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return TraceEvent{}, t.error(err)
+		}
+
+		event := TraceEvent{Op: TraceOp(fields[1][0])}
+		if nanos != 0 {
+			event.Time = time.Unix(0, nanos)
+		}
+
+		if !event.Op.valid() {
+			return TraceEvent{}, t.error(InvalidTraceError)
+		}
+
+		for _, field := range fields[2:] {
+			key, err := url.PathUnescape(field)
+			if err != nil {
+				return TraceEvent{}, t.error(err)
+			}
+
+			event.Keys = append(event.Keys, key)
+		}
+
+		return event, nil
+	}
+
+	if err := t.scanner.Err(); err != nil {
+		return TraceEvent{}, err
+	}
+
+	return TraceEvent{}, io.EOF
+}
+
+func (t *textTraceReader) error(err error) error {
+	return fmt.Errorf("trace line %d: %v", t.line, err)
+}
+
+// The whitespace traceKeyEscaper escapes, which separates fields.
+func isTraceSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	}
+
+	return false
+}
+
+// Writes the text format read by NewTextTraceReader.
+type textTraceWriter struct {
+	w *bufio.Writer
+}
+
+// Writes a text trace to w.
+func NewTextTraceWriter(w io.Writer) TraceWriter {
+	return &textTraceWriter{bufio.NewWriter(w)}
+}
+
+var traceKeyEscaper = strings.NewReplacer("%", "%25", " ", "%20", "\t", "%09", "\n", "%0A", "\r", "%0D", "\v", "%0B", "\f", "%0C")
+
+func (t *textTraceWriter) Write(event TraceEvent) error {
+	if !event.valid() {
+		return InvalidTraceError
+	}
+
+	var nanos int64
+	if !event.Time.IsZero() {
+		nanos = event.Time.UnixNano()
+	}
+
+	t.w.WriteString(strconv.FormatInt(nanos, 10))
+	t.w.WriteByte(' ')
+	t.w.WriteByte(byte(event.Op))
+
+	for _, key := range event.Keys {
+		t.w.WriteByte(' ')
+		t.w.WriteString(traceKeyEscaper.Replace(key))
+	}
+
+	_, err := t.w.WriteString("\n")
+	return err
+}
+
+func (t *textTraceWriter) Flush() error {
+	return t.w.Flush()
+}
+
+/** Binary traces start with "MCTRACE1" followed by one record per event:
+
+	varint   nanoseconds since the previous event (since 0 for the first)
+	byte     operation
+	uvarint  number of keys
+	per key: uvarint length, key bytes
+
+Times are delta encoded so most records take only a few bytes beyond their
+keys.
+**/
+type binaryTraceReader struct {
+	r        *bufio.Reader
+	lastTime int64
+}
+
+// Reads a binary trace from r.
+func NewBinaryTraceReader(r io.Reader) (TraceReader, error) {
+	return newBinaryTraceReader(bufio.NewReader(r))
+}
+
+func newBinaryTraceReader(r *bufio.Reader) (*binaryTraceReader, error) {
+	magic := make([]byte, len(binaryTraceMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != binaryTraceMagic {
+		return nil, InvalidTraceError
+	}
+
+	return &binaryTraceReader{r: r}, nil
+}
+
+func (b *binaryTraceReader) Read() (TraceEvent, error) {
+	delta, err := binary.ReadVarint(b.r)
+	if err == io.EOF {
+		return TraceEvent{}, io.EOF
+	} else if err != nil {
+		return TraceEvent{}, InvalidTraceError
+	}
+
+	op, err := b.r.ReadByte()
+	if err != nil || !TraceOp(op).valid() {
+		return TraceEvent{}, InvalidTraceError
+	}
+
+	// Keys is grown as keys are read, a corrupt count mustn't allocate
+	count, err := binary.ReadUvarint(b.r)
+	if err != nil || count == 0 || count > binaryTraceMaxLength {
+		return TraceEvent{}, InvalidTraceError
+	}
+
+	b.lastTime += delta
+	event := TraceEvent{Op: TraceOp(op)}
+	if b.lastTime != 0 {
+		event.Time = time.Unix(0, b.lastTime)
+	}
+
+	for i := uint64(0); i < count; i++ {
+		length, err := binary.ReadUvarint(b.r)
+		if err != nil || length > binaryTraceMaxLength {
+			return TraceEvent{}, InvalidTraceError
+		}
+
+		key := make([]byte, length)
+		if _, err := io.ReadFull(b.r, key); err != nil {
+			return TraceEvent{}, InvalidTraceError
+		}
+
+		event.Keys = append(event.Keys, string(key))
+	}
+
+	return event, nil
+}
+
+// Writes the binary format read by NewBinaryTraceReader.
+type binaryTraceWriter struct {
+	w        *bufio.Writer
+	lastTime int64
+	started  bool
+	scratch  [binary.MaxVarintLen64]byte
+}
+
+// Writes a binary trace to w.
+func NewBinaryTraceWriter(w io.Writer) TraceWriter {
+	return &binaryTraceWriter{w: bufio.NewWriter(w)}
+}
+
+func (b *binaryTraceWriter) Write(event TraceEvent) error {
+	if !event.valid() {
+		return InvalidTraceError
+	}
+
+	if !b.started {
+		b.w.WriteString(binaryTraceMagic)
+		b.started = true
+	}
+
+	var nanos int64
+	if !event.Time.IsZero() {
+		nanos = event.Time.UnixNano()
+	}
+
+	b.w.Write(b.scratch[:binary.PutVarint(b.scratch[:], nanos-b.lastTime)])
+	b.lastTime = nanos
+
+	b.w.WriteByte(byte(event.Op))
+	b.w.Write(b.scratch[:binary.PutUvarint(b.scratch[:], uint64(len(event.Keys)))])
+
+	for _, key := range event.Keys {
+		b.w.Write(b.scratch[:binary.PutUvarint(b.scratch[:], uint64(len(key)))])
+		b.w.WriteString(key)
+	}
+
+	return nil
+}
+
+func (b *binaryTraceWriter) Flush() error {
+	if !b.started {
+		// An empty trace still needs its header to be recognized.
+		b.w.WriteString(binaryTraceMagic)
+		b.started = true
+	}
+
+	return b.w.Flush()
+}
+
+func (op TraceOp) valid() bool {
+	return op == TraceGet || op == TraceAdd || op == TraceRemove
+}
+
+// Events need a known operation and at least one key, keys can't be empty.
+func (event TraceEvent) valid() bool {
+	if !event.Op.valid() || len(event.Keys) == 0 {
+		return false
+	}
+
+	for _, key := range event.Keys {
+		if key == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Used by tests and tools that want a trace in memory.
+type sliceTraceReader struct {
+	events []TraceEvent
+}
+
+// Returns a TraceReader over events held in memory.
+func NewEventTraceReader(events []TraceEvent) TraceReader {
+	return &sliceTraceReader{events}
+}
+
+// Returns a TraceReader over keys, each of which is a Get.
+func NewKeyTraceReader(keys []string) TraceReader {
+	events := make([]TraceEvent, len(keys))
+	for i, key := range keys {
+		events[i] = TraceEvent{Op: TraceGet, Keys: []string{key}}
+	}
+
+	return &sliceTraceReader{events}
+}
+
+func (s *sliceTraceReader) Read() (TraceEvent, error) {
+	if len(s.events) == 0 {
+		return TraceEvent{}, io.EOF
+	}
+
+	event := s.events[0]
+	s.events = s.events[1:]
+	return event, nil
+}
+
+/**
+Reads the Gets of a whole trace into memory, returning the first key of each
+along with its size. Simulators that need to see the future, such as
+CalculateOptimalSizedHitMiss, use this to load a trace.
+**/
+func ReadTraceGets(trace TraceReader) (keys []string, sizes []int64, err error) {
+	for {
+		event, err := trace.Read()
+		if err == io.EOF {
+			return keys, sizes, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if event.Op != TraceGet || len(event.Keys) == 0 {
+			continue
+		}
+
+		keys = append(keys, event.Keys[0])
+		sizes = append(sizes, event.Size)
+	}
+}
@@ -0,0 +1,211 @@
+package multicache
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Readers for published cache traces. Each returns a TraceReader of Gets that can
+be passed straight to CalculateHitMissTrace.
+**/
+
+/**
+Reads the block traces published with the ARC paper (Megiddo and Modha), where
+each line is
+
+	<starting block> <number of blocks> <ignored> <request number>
+
+Every block of a request becomes a Get keyed by its block number. The traces
+don't carry times or sizes.
+**/
+type arcTraceReader struct {
+	scanner *bufio.Scanner
+	line    int
+
+	// The request currently being expanded into blocks
+	nextBlock uint64
+	remaining uint64
+}
+
+// Reads an ARC style trace from r.
+func NewARCTraceReader(r io.Reader) TraceReader {
+	return &arcTraceReader{scanner: bufio.NewScanner(r)}
+}
+
+func (a *arcTraceReader) Read() (TraceEvent, error) {
+	for a.remaining == 0 {
+		if !a.scanner.Scan() {
+			if err := a.scanner.Err(); err != nil {
+				return TraceEvent{}, err
+			}
+
+			return TraceEvent{}, io.EOF
+		}
+
+		a.line++
+		fields := strings.Fields(a.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 2 {
+			return TraceEvent{}, importError("arc", a.line, InvalidTraceError)
+		}
+
+		start, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return TraceEvent{}, importError("arc", a.line, err)
+		}
+
+		count, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return TraceEvent{}, importError("arc", a.line, err)
+		}
+
+		a.nextBlock, a.remaining = start, count
+	}
+
+	key := strconv.FormatUint(a.nextBlock, 10)
+	a.nextBlock++
+	a.remaining--
+
+	return TraceEvent{Op: TraceGet, Keys: []string{key}}, nil
+}
+
+/**
+Reads the Wikipedia request logs used by WikiBench (Urdaneta, Pierre and van
+Steen), where each line is
+
+	<counter> <unix timestamp> <url> <save flag>
+
+The URL is the key and the timestamp may have a fractional part. Requests that
+save a page (flag "save") are skipped since a cache would never serve them.
+**/
+type wikipediaTraceReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// Reads a Wikipedia style request log from r.
+func NewWikipediaTraceReader(r io.Reader) TraceReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &wikipediaTraceReader{scanner: scanner}
+}
+
+func (w *wikipediaTraceReader) Read() (TraceEvent, error) {
+	for w.scanner.Scan() {
+		w.line++
+		fields := strings.Fields(w.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) < 3 {
+			return TraceEvent{}, importError("wikipedia", w.line, InvalidTraceError)
+		}
+
+		if len(fields) > 3 && fields[3] == "save" {
+			continue
+		}
+
+		timestamp, err := parseUnixSeconds(fields[1])
+		if err != nil {
+			return TraceEvent{}, importError("wikipedia", w.line, err)
+		}
+
+		return TraceEvent{Time: timestamp, Op: TraceGet, Keys: []string{fields[2]}}, nil
+	}
+
+	if err := w.scanner.Err(); err != nil {
+		return TraceEvent{}, err
+	}
+
+	return TraceEvent{}, io.EOF
+}
+
+/**
+Reads comma separated traces with the columns
+
+	<unix timestamp>,<key>[,<size in bytes>]
+
+The timestamp may have a fractional part. A header row is skipped if the
+first row's timestamp isn't a number.
+**/
+type csvTraceReader struct {
+	reader *csv.Reader
+	line   int
+}
+
+// Reads a CSV trace from r.
+func NewCSVTraceReader(r io.Reader) TraceReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+	return &csvTraceReader{reader: reader}
+}
+
+func (c *csvTraceReader) Read() (TraceEvent, error) {
+	for {
+		record, err := c.reader.Read()
+		if err == io.EOF {
+			return TraceEvent{}, io.EOF
+		} else if err != nil {
+			return TraceEvent{}, err
+		}
+
+		c.line++
+		if len(record) < 2 || len(record) > 3 || record[1] == "" {
+			return TraceEvent{}, importError("csv", c.line, InvalidTraceError)
+		}
+
+		timestamp, err := parseUnixSeconds(record[0])
+		if err != nil {
+			if c.line == 1 {
+				// A header row
+				continue
+			}
+
+			return TraceEvent{}, importError("csv", c.line, err)
+		}
+
+		event := TraceEvent{Time: timestamp, Op: TraceGet, Keys: []string{record[1]}}
+		if len(record) == 3 && record[2] != "" {
+			if event.Size, err = strconv.ParseInt(record[2], 10, 64); err != nil || event.Size < 0 {
+				return TraceEvent{}, importError("csv", c.line, InvalidTraceError)
+			}
+		}
+
+		return event, nil
+	}
+}
+
+// Parses seconds since the epoch with an optional fractional part.
+func parseUnixSeconds(s string) (time.Time, error) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, InvalidTraceError
+	}
+
+	// Round to microseconds, floats can't hold nanoseconds this far from 0.
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(math.Round(fraction*1e6))*1000), nil
+}
+
+func importError(format string, line int, err error) error {
+	return fmt.Errorf("%s trace line %d: %v", format, line, err)
+}
@@ -0,0 +1,115 @@
+package multicache
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+type TraceImportTestcase struct {
+	fixture   string
+	newReader func(*os.File) TraceReader
+	keys      []string
+	// Times and sizes of the first event
+	firstTime time.Time
+	firstSize int64
+}
+
+var traceImportTestcases = []TraceImportTestcase{
+	{"testdata/arc.lis",
+		func(f *os.File) TraceReader { return NewARCTraceReader(f) },
+		[]string{"100", "101", "200", "100", "101", "102", "200", "101"},
+		time.Time{}, 0},
+	{"testdata/wikipedia.log",
+		func(f *os.File) TraceReader { return NewWikipediaTraceReader(f) },
+		[]string{
+			"http://en.wikipedia.org/wiki/Main_Page",
+			"http://en.wikipedia.org/wiki/Cache",
+			"http://en.wikipedia.org/wiki/Main_Page",
+			"http://upload.wikimedia.org/wikipedia/commons/a/a9/Example.jpg",
+			"http://en.wikipedia.org/wiki/Cache"},
+		time.Unix(1190146243, 326000000), 0},
+	{"testdata/trace.csv",
+		func(f *os.File) TraceReader { return NewCSVTraceReader(f) },
+		[]string{"/img/logo.png", "/index.html", "/img/logo.png", "/css/site.css", "/index.html", "/search?q=a,b"},
+		time.Unix(1500000000, 0), 2048},
+}
+
+func TestTraceImport(t *testing.T) {
+	for index, test := range traceImportTestcases {
+		file, err := os.Open(test.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events := readAllEvents(t, test.newReader(file))
+		file.Close()
+
+		keys := []string{}
+		for _, event := range events {
+			keys = append(keys, event.Keys[0])
+			if event.Op != TraceGet {
+				t.Error("Imported event isn't a Get, index:", index, "event:", event)
+			}
+		}
+
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Error("Unexpected keys, index:", index, "keys:", keys)
+			continue
+		}
+
+		if !events[0].Time.Equal(test.firstTime) || events[0].Size != test.firstSize {
+			t.Error("Unexpected first event, index:", index, "event:", events[0])
+		}
+
+		// The imported trace feeds the simulator like the equivalent list of keys
+		file, _ = os.Open(test.fixture)
+		ratio, err := CalculateHitMissTrace(test.newReader(file), 3, &LeastRecentlyUsed{})
+		file.Close()
+
+		expected := CalculateHitMiss(test.keys, 3, &LeastRecentlyUsed{})
+		if err != nil || ratio != expected {
+			t.Error("Unexpected hit ratio, index:", index, "ratio:", ratio, "expected:", expected, "err:", err)
+		}
+	}
+}
+
+func TestTraceImportFractionalTimes(t *testing.T) {
+	event, _ := NewCSVTraceReader(strings.NewReader("1500000000.5,a,10\n")).Read()
+	assert(t, event.Time.Equal(time.Unix(1500000000, 500000000)), "Fractional seconds lost")
+	assert(t, event.Size == 10, "Size not read")
+}
+
+func TestTraceImportInvalid(t *testing.T) {
+	invalid := []TraceReader{
+		NewARCTraceReader(strings.NewReader("100\n")),
+		NewARCTraceReader(strings.NewReader("x 1 0 1\n")),
+		NewWikipediaTraceReader(strings.NewReader("1 2\n")),
+		NewWikipediaTraceReader(strings.NewReader("1 yesterday http://x -\n")),
+		NewCSVTraceReader(strings.NewReader("1,a\nsoon,b\n")),
+		NewCSVTraceReader(strings.NewReader("1,a,big\n")),
+		NewCSVTraceReader(strings.NewReader("1\n")),
+	}
+
+	for index, reader := range invalid {
+		var err error
+		for err == nil {
+			_, err = reader.Read()
+		}
+
+		if err == io.EOF {
+			t.Error("Invalid trace accepted, index:", index)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package multicache
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+var traceTestEvents = []TraceEvent{
+	{Time: time.Unix(0, 1000), Op: TraceGet, Keys: []string{"a"}},
+	{Time: time.Unix(0, 2500), Op: TraceAdd, Keys: []string{"a", "b"}},
+	{Time: time.Unix(0, 2500), Op: TraceRemove, Keys: []string{"b"}},
+	// Unknown times and keys that need escaping
+	{Op: TraceGet, Keys: []string{"with space", "tab\there", "100%", "new\nline"}},
+	{Time: time.Unix(5, 0), Op: TraceAdd, Keys: []string{"#not-a-comment", "ключ", "no\u00a0break", "next\u0085line"}},
+}
+
+func readAllEvents(t *testing.T, trace TraceReader) []TraceEvent {
+	events := []TraceEvent{}
+	for {
+		event, err := trace.Read()
+		if err == io.EOF {
+			return events
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		events = append(events, event)
+	}
+}
+
+func sameEvents(a, b []TraceEvent) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].Time.Equal(b[i].Time) || a[i].Op != b[i].Op || !reflect.DeepEqual(a[i].Keys, b[i].Keys) || a[i].Size != b[i].Size {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestTraceRoundTrip(t *testing.T) {
+	writers := map[string]func(io.Writer) TraceWriter{
+		"text":   NewTextTraceWriter,
+		"binary": NewBinaryTraceWriter,
+	}
+
+	for name, newWriter := range writers {
+		var buffer bytes.Buffer
+		writer := newWriter(&buffer)
+
+		for _, event := range traceTestEvents {
+			if err := writer.Write(event); err != nil {
+				t.Fatal(name, err)
+			}
+		}
+		writer.Flush()
+
+		// Format detection picks the right reader
+		reader, err := NewTraceReader(bytes.NewReader(buffer.Bytes()))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		events := readAllEvents(t, reader)
+		assert(t, sameEvents(events, traceTestEvents), name+" trace didn't round trip")
+	}
+}
+
+func TestTraceBinaryIsCompact(t *testing.T) {
+	var text, binary bytes.Buffer
+	textWriter, binaryWriter := NewTextTraceWriter(&text), NewBinaryTraceWriter(&binary)
+
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		event := TraceEvent{Time: start.Add(time.Duration(i) * time.Microsecond), Op: TraceGet, Keys: []string{"key"}}
+		textWriter.Write(event)
+		binaryWriter.Write(event)
+	}
+	textWriter.Flush()
+	binaryWriter.Flush()
+
+	assert(t, binary.Len()*3 < text.Len(), "Binary trace isn't much smaller than text")
+}
+
+func TestTraceTextKeysOnly(t *testing.T) {
+	trace := NewTextTraceReader(strings.NewReader("# a comment\na\n\nb%20c\n100 R a\n"))
+	events := readAllEvents(t, trace)
+
+	expected := []TraceEvent{
+		{Op: TraceGet, Keys: []string{"a"}},
+		{Op: TraceGet, Keys: []string{"b c"}},
+		{Time: time.Unix(0, 100), Op: TraceRemove, Keys: []string{"a"}},
+	}
+
+	assert(t, sameEvents(events, expected), "Plain key list read incorrectly")
+}
+
+func TestTraceInvalid(t *testing.T) {
+	invalidText := []string{
+		"100 X key\n",
+		"100 G\n",
+		"notatime G key\n",
+		"100 G bad%zzescape\n",
+	}
+
+	for _, text := range invalidText {
+		_, err := NewTextTraceReader(strings.NewReader(text)).Read()
+		assert(t, err != nil && err != io.EOF, "Invalid text trace accepted: "+text)
+	}
+
+	_, err := NewBinaryTraceReader(strings.NewReader("NOTATRACE"))
+	assert(t, err == InvalidTraceError, "Binary trace without header accepted")
+
+	reader, _ := NewBinaryTraceReader(strings.NewReader(binaryTraceMagic + "\x00G\x01\x05ab"))
+	_, err = reader.Read()
+	assert(t, err == InvalidTraceError, "Truncated binary trace accepted")
+
+	// A corrupt key count is rejected rather than allocated
+	reader, _ = NewBinaryTraceReader(strings.NewReader(binaryTraceMagic + "\x00G\xff\xff\xff\xff\xff\xff\xff\xff\x7fab"))
+	_, err = reader.Read()
+	assert(t, err == InvalidTraceError, "Corrupt binary key count accepted")
+
+	var buffer bytes.Buffer
+	writer := NewTextTraceWriter(&buffer)
+	assert(t, writer.Write(TraceEvent{Op: TraceGet}) == InvalidTraceError, "Event without keys written")
+	assert(t, writer.Write(TraceEvent{Op: TraceGet, Keys: []string{""}}) == InvalidTraceError, "Empty key written")
+}
+
+func TestTraceEmptyBinary(t *testing.T) {
+	var buffer bytes.Buffer
+	NewBinaryTraceWriter(&buffer).Flush()
+
+	reader, err := NewTraceReader(&buffer)
+	assert(t, err == nil, "Empty binary trace not recognized")
+
+	_, err = reader.Read()
+	assert(t, err == io.EOF, "Empty binary trace had events")
+}
@@ -0,0 +1,313 @@
+package workload
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+
+Package workload generates synthetic access patterns for benchmarking caches.
+Every generator is deterministic given its seed so results can be reproduced,
+and keys are the numbers 0 to keys-1 as strings unless noted otherwise.
+**/
+
+// A single lookup made by a workload.
+type Request struct {
+	// The key looked up
+	Key string
+	// Every key of the item Key belongs to, Key included, so a miss can add
+	// them together with AddMany. Nil when items have a single key.
+	Aliases []string
+}
+
+// Generator produces an endless stream of requests.
+type Generator interface {
+	Next() Request
+}
+
+// Returns the next n requests from g.
+func Requests(g Generator, n int) []Request {
+	requests := make([]Request, n)
+	for i := range requests {
+		requests[i] = g.Next()
+	}
+
+	return requests
+}
+
+// Returns the keys of the next n requests from g, suitable for
+// CalculateHitMiss.
+func Keys(g Generator, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = g.Next().Key
+	}
+
+	return keys
+}
+
+/**
+Returns the next n requests from g as a trace of Gets. Requests with aliases
+list them after the key looked up, so CalculateMultiKeyHitMiss can group them.
+**/
+func Trace(g Generator, n int) multicache.TraceReader {
+	events := make([]multicache.TraceEvent, n)
+	for i := range events {
+		request := g.Next()
+		keys := []string{request.Key}
+		for _, alias := range request.Aliases {
+			if alias != request.Key {
+				keys = append(keys, alias)
+			}
+		}
+
+		events[i] = multicache.TraceEvent{Op: multicache.TraceGet, Keys: keys}
+	}
+
+	return multicache.NewEventTraceReader(events)
+}
+
+func keyName(key int) string {
+	return strconv.Itoa(key)
+}
+
+// Every key is equally likely.
+type Uniform struct {
+	random *rand.Rand
+	keys   int
+}
+
+func NewUniform(seed int64, keys int) *Uniform {
+	return &Uniform{rand.New(rand.NewSource(seed)), keys}
+}
+
+func (u *Uniform) Next() Request {
+	return Request{Key: keyName(u.random.Intn(u.keys))}
+}
+
+/**
+Key i is requested with probability proportional to 1/(i+1)^skew, so key 0 is
+the most popular. A skew of 0 is uniform, around 1 is typical of web traffic
+and larger values concentrate requests on fewer keys.
+**/
+type Zipfian struct {
+	random *rand.Rand
+	// cumulative[i] is the probability of requesting a key <= i
+	cumulative []float64
+}
+
+func NewZipfian(seed int64, keys int, skew float64) *Zipfian {
+	cumulative := make([]float64, keys)
+	total := 0.0
+	for i := range cumulative {
+		total += 1 / math.Pow(float64(i+1), skew)
+		cumulative[i] = total
+	}
+
+	for i := range cumulative {
+		cumulative[i] /= total
+	}
+
+	return &Zipfian{rand.New(rand.NewSource(seed)), cumulative}
+}
+
+func (z *Zipfian) Next() Request {
+	key := sort.SearchFloat64s(z.cumulative, z.random.Float64())
+	if key == len(z.cumulative) {
+		key--
+	}
+
+	return Request{Key: keyName(key)}
+}
+
+/**
+Requests a uniformly chosen key from a small hot set, occasionally interrupted
+by a sequential scan through the cold keys like a batch job or crawler would
+make. Scans pick up where the last one finished.
+
+Hot keys are 0 to hotKeys-1 and cold keys hotKeys to hotKeys+coldKeys-1.
+**/
+type ScanHotSet struct {
+	random     *rand.Rand
+	hotKeys    int
+	coldKeys   int
+	scanLength int
+	scanChance float64
+
+	// Requests left in the current scan and the next cold key to scan
+	scanLeft int
+	scanNext int
+}
+
+// Each request starts a scan of scanLength cold keys with probability
+// scanChance.
+func NewScanHotSet(seed int64, hotKeys, coldKeys, scanLength int, scanChance float64) *ScanHotSet {
+	return &ScanHotSet{
+		random:     rand.New(rand.NewSource(seed)),
+		hotKeys:    hotKeys,
+		coldKeys:   coldKeys,
+		scanLength: scanLength,
+		scanChance: scanChance,
+	}
+}
+
+func (s *ScanHotSet) Next() Request {
+	if s.scanLeft == 0 && s.coldKeys > 0 && s.random.Float64() < s.scanChance {
+		s.scanLeft = s.scanLength
+	}
+
+	if s.scanLeft > 0 {
+		s.scanLeft--
+		key := s.hotKeys + s.scanNext
+		s.scanNext = (s.scanNext + 1) % s.coldKeys
+		return Request{Key: keyName(key)}
+	}
+
+	return Request{Key: keyName(s.random.Intn(s.hotKeys))}
+}
+
+/**
+Requests come from a window of hotKeys consecutive keys with probability
+hotChance and from all keys otherwise. Every shiftEvery requests the window
+moves on to the next hotKeys keys, wrapping around, like the popular items of
+a news site changing over the day.
+**/
+type ShiftingHotSet struct {
+	random     *rand.Rand
+	keys       int
+	hotKeys    int
+	hotChance  float64
+	shiftEvery int
+
+	requests int
+	offset   int
+}
+
+func NewShiftingHotSet(seed int64, keys, hotKeys int, hotChance float64, shiftEvery int) *ShiftingHotSet {
+	return &ShiftingHotSet{
+		random:     rand.New(rand.NewSource(seed)),
+		keys:       keys,
+		hotKeys:    hotKeys,
+		hotChance:  hotChance,
+		shiftEvery: shiftEvery,
+	}
+}
+
+func (s *ShiftingHotSet) Next() Request {
+	if s.shiftEvery > 0 && s.requests > 0 && s.requests%s.shiftEvery == 0 {
+		s.offset = (s.offset + s.hotKeys) % s.keys
+	}
+	s.requests++
+
+	if s.random.Float64() < s.hotChance {
+		return Request{Key: keyName((s.offset + s.random.Intn(s.hotKeys)) % s.keys)}
+	}
+
+	return Request{Key: keyName(s.random.Intn(s.keys))}
+}
+
+/**
+Requests keys 0 to length-1 in order, over and over. LRU misses every request
+once the loop is larger than the cache, which makes this a good worst case.
+**/
+type Loop struct {
+	length int
+	next   int
+}
+
+func NewLoop(length int) *Loop {
+	return &Loop{length: length}
+}
+
+func (l *Loop) Next() Request {
+	key := l.next
+	l.next = (l.next + 1) % l.length
+	return Request{Key: keyName(key)}
+}
+
+/**
+With probability repeatChance repeats one of the last window requests,
+otherwise requests a uniformly chosen key. This is the pattern the examples
+have always used to imitate users revisiting what they just looked at.
+**/
+type RepeatChance struct {
+	random       *rand.Rand
+	keys         int
+	window       int
+	repeatChance float64
+
+	recent []string
+}
+
+func NewRepeatChance(seed int64, keys, window int, repeatChance float64) *RepeatChance {
+	return &RepeatChance{
+		random:       rand.New(rand.NewSource(seed)),
+		keys:         keys,
+		window:       window,
+		repeatChance: repeatChance,
+	}
+}
+
+func (r *RepeatChance) Next() Request {
+	var key string
+	if len(r.recent) >= r.window && r.window > 0 && r.random.Float64() < r.repeatChance {
+		key = r.recent[len(r.recent)-1-r.random.Intn(r.window)]
+	} else {
+		key = keyName(r.random.Intn(r.keys))
+	}
+
+	r.recent = append(r.recent, key)
+	if len(r.recent) > 2*r.window {
+		r.recent = append(r.recent[:0], r.recent[len(r.recent)-r.window:]...)
+	}
+
+	return Request{Key: key}
+}
+
+/**
+Turns the keys of another generator into items with several keys. Key k
+becomes an item with the aliases k/0 to k/n-1, n being between 1 and
+maxAliases and fixed for each item, and each request looks up one of them at
+random. Requests carry every alias so misses can be filled with AddMany.
+**/
+type MultiKey struct {
+	base       Generator
+	random     *rand.Rand
+	maxAliases int
+	seed       int64
+}
+
+func NewMultiKey(seed int64, base Generator, maxAliases int) *MultiKey {
+	return &MultiKey{
+		base:       base,
+		random:     rand.New(rand.NewSource(seed)),
+		maxAliases: maxAliases,
+		seed:       seed,
+	}
+}
+
+func (m *MultiKey) Next() Request {
+	key := m.base.Next().Key
+
+	// The alias count is derived from the key so it never changes.
+	hash := fnv.New64a()
+	hash.Write([]byte(strconv.FormatInt(m.seed, 10) + ":" + key))
+	count := 1 + int(hash.Sum64()%uint64(m.maxAliases))
+	aliases := make([]string, count)
+	for i := range aliases {
+		aliases[i] = key + "/" + strconv.Itoa(i)
+	}
+
+	return Request{Key: aliases[m.random.Intn(count)], Aliases: aliases}
+}
@@ -0,0 +1,139 @@
+package workload
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/josephlewis42/multicache"
+)
+
+/**
+This file is part of multicache, a library for handling caches with multiple
+keys and replacement algorithms.
+
+Copyright 2015 Joseph Lewis <joseph@josephlewis.net>
+Licensed under the MIT license
+**/
+
+func assert(t *testing.T, assertion bool, errinfo string) {
+	if !assertion {
+		t.Error(errinfo)
+	}
+}
+
+func counts(keys []string) map[string]int {
+	result := make(map[string]int)
+	for _, key := range keys {
+		result[key]++
+	}
+
+	return result
+}
+
+func TestDeterministic(t *testing.T) {
+	generators := map[string]func() Generator{
+		"uniform":  func() Generator { return NewUniform(7, 100) },
+		"zipfian":  func() Generator { return NewZipfian(7, 100, 0.99) },
+		"scan":     func() Generator { return NewScanHotSet(7, 10, 100, 20, 0.05) },
+		"shifting": func() Generator { return NewShiftingHotSet(7, 100, 10, 0.9, 50) },
+		"repeat":   func() Generator { return NewRepeatChance(7, 100, 3, 0.8) },
+		"multikey": func() Generator { return NewMultiKey(7, NewUniform(7, 100), 4) },
+	}
+
+	for name, create := range generators {
+		first, second := Requests(create(), 1000), Requests(create(), 1000)
+		assert(t, reflect.DeepEqual(first, second), name+" isn't deterministic")
+	}
+
+	assert(t, !reflect.DeepEqual(Keys(NewUniform(1, 100), 100), Keys(NewUniform(2, 100), 100)), "Seed ignored")
+}
+
+func TestZipfian(t *testing.T) {
+	seen := counts(Keys(NewZipfian(1, 1000, 1.2), 100000))
+	assert(t, seen["0"] > seen["1"] && seen["1"] > seen["10"] && seen["10"] > seen["500"], "Not skewed")
+
+	for key := range seen {
+		number, _ := strconv.Atoi(key)
+		assert(t, number >= 0 && number < 1000, "Key out of range: "+key)
+	}
+
+	// No skew is uniform
+	seen = counts(Keys(NewZipfian(1, 10, 0), 100000))
+	assert(t, seen["0"] > 9000 && seen["0"] < 11000, "Zero skew not uniform")
+}
+
+func TestScanHotSet(t *testing.T) {
+	keys := Keys(NewScanHotSet(1, 5, 100, 10, 0.01), 10000)
+
+	scans := 0
+	for i, key := range keys {
+		number, _ := strconv.Atoi(key)
+		if number < 5 {
+			continue
+		}
+
+		scans++
+		if i > 0 {
+			previous, _ := strconv.Atoi(keys[i-1])
+			assert(t, previous < 5 || number == previous+1 || (previous == 104 && number == 5), "Scan not sequential")
+		}
+	}
+
+	// About 10000 * 0.01 scans of 10 keys
+	assert(t, scans > 500 && scans < 2000 && scans%10 == 0, "Unexpected scan count "+strconv.Itoa(scans))
+}
+
+func TestShiftingHotSet(t *testing.T) {
+	generator := NewShiftingHotSet(1, 100, 10, 1, 100)
+
+	first := counts(Keys(generator, 100))
+	second := counts(Keys(generator, 100))
+	assert(t, len(first) <= 10 && first["95"] == 0, "Requests left the hot set")
+	assert(t, second["5"] == 0 && len(second) <= 10, "Hot set didn't shift")
+	for key := range second {
+		number, _ := strconv.Atoi(key)
+		assert(t, number >= 10 && number < 20, "Hot set shifted to the wrong keys")
+	}
+}
+
+func TestLoop(t *testing.T) {
+	assert(t, reflect.DeepEqual(Keys(NewLoop(3), 7), []string{"0", "1", "2", "0", "1", "2", "0"}), "Unexpected loop")
+}
+
+func TestRepeatChance(t *testing.T) {
+	keys := Keys(NewRepeatChance(1, 1000, 3, 1), 100)
+
+	// Everything after the first few repeats one of them
+	assert(t, len(counts(keys)) == 3, "Always repeating should stay on the first keys")
+}
+
+func TestMultiKey(t *testing.T) {
+	aliasCounts := make(map[string]int)
+	for _, request := range Requests(NewMultiKey(1, NewUniform(1, 50), 3), 1000) {
+		assert(t, len(request.Aliases) >= 1 && len(request.Aliases) <= 3, "Wrong number of aliases")
+
+		item := strings.Split(request.Key, "/")[0]
+		found := false
+		for _, alias := range request.Aliases {
+			found = found || alias == request.Key
+			assert(t, strings.HasPrefix(alias, item+"/"), "Alias of another item")
+		}
+		assert(t, found, "Key isn't one of its aliases")
+
+		if count, ok := aliasCounts[item]; ok {
+			assert(t, count == len(request.Aliases), "Alias count changed")
+		}
+		aliasCounts[item] = len(request.Aliases)
+	}
+}
+
+func TestTraceMultiKey(t *testing.T) {
+	newAlgorithm := func() multicache.ReplacementAlgorithm { return &multicache.LeastRecentlyUsed{} }
+	generator := NewMultiKey(1, NewZipfian(1, 200, 0.8), 4)
+
+	result, err := multicache.CalculateMultiKeyHitMiss(Trace(generator, 20000), 50, newAlgorithm)
+	assert(t, err == nil, "Simulation failed")
+	assert(t, result.HitRatio > result.SingleKeyHitRatio, "Grouping aliases should raise the hit ratio")
+}